@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"log"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
@@ -59,6 +60,19 @@ type Adapter struct {
 	timeoutWaitGroup       *timeoutwaitgroup.TimeoutWaitGroup
 	sourceIndex            string
 	metricsToSyslogEnabled bool
+	httpsBatchSize         int
+	httpsBatchDelay        time.Duration
+	breakerThreshold       int
+	breakerOpenTimeout     time.Duration
+	spillDir               string
+	spillMaxBindingBytes   int64
+	spillMaxTotalBytes     int64
+	retryStrategy          egress.RetryStrategy
+	drainTLSConfig         *tls.Config
+	rateLimit              ingress.RateLimit
+	redactionRules         []egress.RedactionRule
+	sharedConnections      int
+	drainProxy             *egress.Proxy
 }
 
 // AdapterOption is a type that will manipulate a config
@@ -142,6 +156,90 @@ func WithMetricsToSyslogEnabled(enabled bool) AdapterOption {
 	}
 }
 
+// WithHTTPSBatching sets the default batch size in bytes and batch delay for
+// HTTPS drains. By default HTTPS drains send one message per request.
+func WithHTTPSBatching(size int, delay time.Duration) AdapterOption {
+	return func(a *Adapter) {
+		a.httpsBatchSize = size
+		a.httpsBatchDelay = delay
+	}
+}
+
+// WithCircuitBreaker sets the number of consecutive failed writes after
+// which a drain's circuit breaker opens and how long it stays open before a
+// probe is sent. A threshold of zero disables the circuit breaker.
+func WithCircuitBreaker(threshold int, openTimeout time.Duration) AdapterOption {
+	return func(a *Adapter) {
+		a.breakerThreshold = threshold
+		a.breakerOpenTimeout = openTimeout
+	}
+}
+
+// WithSpill enables spilling envelopes that do not fit into memory to the
+// given directory. Each connection of a binding may use up to
+// maxBindingBytes and all bindings together up to maxTotalBytes. Spilling is
+// disabled by default.
+func WithSpill(dir string, maxBindingBytes, maxTotalBytes int64) AdapterOption {
+	return func(a *Adapter) {
+		a.spillDir = dir
+		a.spillMaxBindingBytes = maxBindingBytes
+		a.spillMaxTotalBytes = maxTotalBytes
+	}
+}
+
+// WithDrainTLSConfig sets the TLS config used to connect to syslog-tls and
+// https drains. By default api.NewTLSConfig is used.
+func WithDrainTLSConfig(c *tls.Config) AdapterOption {
+	return func(a *Adapter) {
+		a.drainTLSConfig = c
+	}
+}
+
+// WithRateLimit sets the number of envelopes and bytes per second each
+// binding may write. Bindings can override it with the rate-limit drain URL
+// parameter. Zero means unlimited, which is the default.
+func WithRateLimit(envelopes, bytes int) AdapterOption {
+	return func(a *Adapter) {
+		a.rateLimit = ingress.RateLimit{Envelopes: envelopes, Bytes: bytes}
+	}
+}
+
+// WithRedactionRules sets the rules used to redact log payloads. By default
+// nothing is redacted.
+func WithRedactionRules(rules []egress.RedactionRule) AdapterOption {
+	return func(a *Adapter) {
+		a.redactionRules = rules
+	}
+}
+
+// WithSharedConnections lets syslog and syslog-tls bindings that write to
+// the same destination share up to n connections. By default every binding
+// opens its own connection.
+func WithSharedConnections(n int) AdapterOption {
+	return func(a *Adapter) {
+		a.sharedConnections = n
+	}
+}
+
+// WithDrainProxy sets the proxy used to connect to drains. By default drains
+// are connected to directly.
+func WithDrainProxy(p *egress.Proxy) AdapterOption {
+	return func(a *Adapter) {
+		a.drainProxy = p
+	}
+}
+
+// WithRetryStrategy sets the backoff used between retries of failed writes.
+// It must be one of the names in egress.RetryStrategies. The default is
+// exponential.
+func WithRetryStrategy(name string) AdapterOption {
+	return func(a *Adapter) {
+		if s, ok := egress.RetryStrategies[name]; ok {
+			a.retryStrategy = s
+		}
+	}
+}
+
 // maxRetries for the backoff, results in around an hour of total delay
 const maxRetries int = 22
 
@@ -175,6 +273,9 @@ func NewAdapter(
 		timeoutWaitGroup:       timeoutwaitgroup.New(time.Minute),
 		sourceIndex:            sourceIndex,
 		metricsToSyslogEnabled: false,
+		breakerThreshold:       15,
+		breakerOpenTimeout:     time.Minute,
+		retryStrategy:          egress.RetryStrategies["exponential"],
 	}
 
 	for _, o := range opts {
@@ -197,28 +298,61 @@ func NewAdapter(
 		time.Second,
 	)
 
-	constructors := map[string]egress.WriterConstructor{
-		"https": egress.RetryWrapper(
-			egress.NewHTTPSWriter,
-			egress.ExponentialDuration,
-			maxRetries,
-			logClient,
-			sourceIndex,
-		),
-		"syslog": egress.RetryWrapper(
-			egress.NewTCPWriter,
-			egress.ExponentialDuration,
-			maxRetries,
-			logClient,
-			sourceIndex,
+	// metric-documentation-v2: (adapter.https_egress_bytes) Number of bytes
+	// sent to https drains before compression.
+	httpsEgressBytes := buildMetric(metricClient, "https_egress_bytes")
+	// metric-documentation-v2: (adapter.https_egress_compressed_bytes) Number
+	// of bytes sent to https drains after compression.
+	httpsCompressedBytes := buildMetric(metricClient, "https_egress_compressed_bytes")
+
+	breakers := egress.NewCircuitBreakerReporter(
+		metricClient,
+		a.health,
+		// metric-documentation-v2: (adapter.dropped) Number of envelopes
+		// dropped because the circuit breaker of a drain is open.
+		metricClient.NewCounterMetric(
+			"dropped",
+			pulseemitter.WithVersion(2, 0),
+			pulseemitter.WithTags(map[string]string{"reason": "circuit_open"}),
 		),
-		"syslog-tls": egress.RetryWrapper(
-			egress.NewTLSWriter,
-			egress.ExponentialDuration,
+		logClient,
+		sourceIndex,
+	)
+	retryWrapper := func(wc egress.WriterConstructor) egress.WriterConstructor {
+		return egress.RetryStrategyWrapper(
+			egress.CircuitBreakerWrapper(
+				wc,
+				a.breakerThreshold,
+				a.breakerOpenTimeout,
+				breakers,
+			),
+			a.retryStrategy,
 			maxRetries,
 			logClient,
 			sourceIndex,
-		),
+		)
+	}
+
+	splunkConstructor := retryWrapper(egress.SplunkWriterConstructor(
+		egress.WithHTTPSByteMetrics(httpsEgressBytes, httpsCompressedBytes),
+		egress.WithHTTPSTLSConfig(a.drainTLSConfig),
+	))
+	otlpConstructor := retryWrapper(egress.OTLPWriterConstructor(a.drainTLSConfig))
+	constructors := map[string]egress.WriterConstructor{
+		"https": retryWrapper(egress.HTTPSWriterConstructor(
+			egress.WithHTTPSBatching(a.httpsBatchSize, a.httpsBatchDelay),
+			egress.WithHTTPSByteMetrics(httpsEgressBytes, httpsCompressedBytes),
+			egress.WithHTTPSTLSConfig(a.drainTLSConfig),
+		)),
+		"splunk":        splunkConstructor,
+		"splunk-hec":    splunkConstructor,
+		"elasticsearch": retryWrapper(egress.ElasticsearchWriterConstructor(a.drainTLSConfig)),
+		"loki":          retryWrapper(egress.LokiWriterConstructor(a.drainTLSConfig)),
+		"otlp-grpc":     otlpConstructor,
+		"otlp-http":     otlpConstructor,
+		"syslog":        retryWrapper(egress.NewTCPWriter),
+		"syslog-tls":    retryWrapper(egress.TLSWriterConstructor(a.drainTLSConfig)),
+		"syslog-udp":    retryWrapper(egress.NewUDPWriter),
 	}
 
 	droppedMetrics := map[string]pulseemitter.CounterMetric{
@@ -231,6 +365,27 @@ func NewAdapter(
 		// metric-documentation-v2: (adapter.dropped) Number of envelopes dropped
 		// when sending to a syslog drain over syslog-tls.
 		"syslog-tls": buildMetric(metricClient, "dropped"),
+		// metric-documentation-v2: (adapter.dropped) Number of envelopes dropped
+		// when sending to a syslog drain over syslog-udp.
+		"syslog-udp": buildMetric(metricClient, "dropped"),
+		// metric-documentation-v2: (adapter.dropped) Number of envelopes dropped
+		// when sending to a Splunk drain.
+		"splunk": buildMetric(metricClient, "dropped"),
+		// metric-documentation-v2: (adapter.dropped) Number of envelopes dropped
+		// when sending to a Splunk drain over splunk-hec.
+		"splunk-hec": buildMetric(metricClient, "dropped"),
+		// metric-documentation-v2: (adapter.dropped) Number of envelopes dropped
+		// when sending to an Elasticsearch drain.
+		"elasticsearch": buildMetric(metricClient, "dropped"),
+		// metric-documentation-v2: (adapter.dropped) Number of envelopes dropped
+		// when sending to a Loki drain.
+		"loki": buildMetric(metricClient, "dropped"),
+		// metric-documentation-v2: (adapter.dropped) Number of envelopes dropped
+		// when sending to an OpenTelemetry collector over otlp-grpc.
+		"otlp-grpc": buildMetric(metricClient, "dropped"),
+		// metric-documentation-v2: (adapter.dropped) Number of envelopes dropped
+		// when sending to an OpenTelemetry collector over otlp-http.
+		"otlp-http": buildMetric(metricClient, "dropped"),
 	}
 
 	egressMetrics := map[string]pulseemitter.CounterMetric{
@@ -243,6 +398,63 @@ func NewAdapter(
 		// metric-documentation-v2: (adapter.egress) Number of envelopes sent out
 		// to a syslog drain over syslog-tls.
 		"syslog-tls": buildMetric(metricClient, "egress"),
+		// metric-documentation-v2: (adapter.egress) Number of envelopes sent out
+		// to a syslog drain over syslog-udp.
+		"syslog-udp": buildMetric(metricClient, "egress"),
+		// metric-documentation-v2: (adapter.egress) Number of envelopes sent out
+		// to a Splunk drain.
+		"splunk": buildMetric(metricClient, "egress"),
+		// metric-documentation-v2: (adapter.egress) Number of envelopes sent out
+		// to a Splunk drain over splunk-hec.
+		"splunk-hec": buildMetric(metricClient, "egress"),
+		// metric-documentation-v2: (adapter.egress) Number of documents sent
+		// to an Elasticsearch drain.
+		"elasticsearch": buildMetric(metricClient, "egress"),
+		// metric-documentation-v2: (adapter.egress) Number of entries sent to a
+		// Loki drain.
+		"loki": buildMetric(metricClient, "egress"),
+		// metric-documentation-v2: (adapter.egress) Number of envelopes sent
+		// to an OpenTelemetry collector over otlp-grpc.
+		"otlp-grpc": buildMetric(metricClient, "egress"),
+		// metric-documentation-v2: (adapter.egress) Number of envelopes sent
+		// to an OpenTelemetry collector over otlp-http.
+		"otlp-http": buildMetric(metricClient, "egress"),
+	}
+
+	connectionMetrics := make([]pulseemitter.CounterMetric, egress.MaxConnections)
+	for i := range connectionMetrics {
+		// metric-documentation-v2: (adapter.connection_egress) Number of
+		// envelopes sent out over one of the parallel connections of syslog
+		// and syslog-tls drains, tagged with the connection index. The
+		// count covers that connection of all bindings on the adapter.
+		connectionMetrics[i] = metricClient.NewCounterMetric("connection_egress",
+			pulseemitter.WithVersion(2, 0),
+			pulseemitter.WithTags(map[string]string{"connection": strconv.Itoa(i)}),
+		)
+	}
+
+	connectorOpts := []egress.ConnectorOption{
+		egress.WithConstructors(constructors),
+		egress.WithDroppedMetrics(droppedMetrics),
+		egress.WithEgressMetrics(egressMetrics),
+		egress.WithLogClient(logClient, a.sourceIndex),
+		egress.WithConnectionMetrics(connectionMetrics),
+		egress.WithSharedConnections(a.sharedConnections),
+		egress.WithProxy(a.drainProxy),
+		egress.WithRedaction(
+			a.redactionRules,
+			// metric-documentation-v2: (adapter.redacted) Number of matches
+			// of redaction rules replaced in log payloads.
+			buildMetric(metricClient, "redacted"),
+		),
+	}
+	if a.spillDir != "" {
+		store, err := egress.NewSpillStore(a.spillDir, a.spillMaxBindingBytes, a.spillMaxTotalBytes)
+		if err != nil {
+			log.Printf("spilling to disk disabled: %s", err)
+		} else {
+			connectorOpts = append(connectorOpts, egress.WithSpillStore(store))
+		}
 	}
 
 	syslogConnector := egress.NewSyslogConnector(
@@ -253,10 +465,7 @@ func NewAdapter(
 		},
 		a.skipCertVerify,
 		a.timeoutWaitGroup,
-		egress.WithConstructors(constructors),
-		egress.WithDroppedMetrics(droppedMetrics),
-		egress.WithEgressMetrics(egressMetrics),
-		egress.WithLogClient(logClient, a.sourceIndex),
+		connectorOpts...,
 	)
 	subscriber := ingress.NewSubscriber(
 		a.ctx,
@@ -265,6 +474,7 @@ func NewAdapter(
 		metricClient,
 		ingress.WithLogClient(logClient, a.sourceIndex),
 		ingress.WithMetricsToSyslogEnabled(a.metricsToSyslogEnabled),
+		ingress.WithRateLimit(a.rateLimit),
 	)
 
 	a.bindingManager = binding.NewBindingManager(
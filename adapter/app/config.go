@@ -6,6 +6,7 @@ import (
 	"time"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
 	"golang.org/x/net/idna"
 )
 
@@ -31,6 +32,24 @@ type Config struct {
 	SyslogSkipCertVerify   bool          `env:"SYSLOG_SKIP_CERT_VERIFY"`
 	MetricsToSyslogEnabled bool          `env:"METRICS_TO_SYSLOG_ENABLED"`
 	MaxBindings            int           `env:"MAX_BINDINGS"`
+	HTTPSBatchSize         int           `env:"HTTPS_BATCH_SIZE"`
+	HTTPSBatchDelay        time.Duration `env:"HTTPS_BATCH_DELAY"`
+	BreakerThreshold       int           `env:"CIRCUIT_BREAKER_THRESHOLD"`
+	BreakerOpenTimeout     time.Duration `env:"CIRCUIT_BREAKER_OPEN_TIMEOUT"`
+	SpillDir               string        `env:"SPILL_DIR"`
+	SpillMaxBindingBytes   int64         `env:"SPILL_MAX_BINDING_BYTES"`
+	SpillMaxTotalBytes     int64         `env:"SPILL_MAX_TOTAL_BYTES"`
+	RetryStrategy          string        `env:"RETRY_STRATEGY"`
+	DrainCAFile            string        `env:"DRAIN_CA_FILE_PATH"`
+	DrainTLSMinVersion     string        `env:"DRAIN_TLS_MIN_VERSION"`
+	DrainTLSCipherSuites   []string      `env:"DRAIN_TLS_CIPHER_SUITES"`
+	RateLimitEnvelopes     int           `env:"RATE_LIMIT_ENVELOPES"`
+	RateLimitBytes         int           `env:"RATE_LIMIT_BYTES"`
+	RedactionRulesFile     string        `env:"REDACTION_RULES_FILE"`
+	SharedConnections      int           `env:"SHARED_CONNECTIONS"`
+	DrainHTTPProxy         string        `env:"DRAIN_HTTP_PROXY"`
+	DrainSOCKS5Proxy       string        `env:"DRAIN_SOCKS5_PROXY"`
+	DrainNoProxy           []string      `env:"DRAIN_NO_PROXY"`
 
 	MetricIngressAddr     string        `env:"METRIC_INGRESS_ADDR,     required"`
 	MetricIngressCN       string        `env:"METRIC_INGRESS_CN,       required"`
@@ -51,6 +70,11 @@ func LoadConfig() *Config {
 		MetricEmitterInterval:  time.Minute,
 		MetricsToSyslogEnabled: false,
 		MaxBindings:            500,
+		BreakerThreshold:       15,
+		BreakerOpenTimeout:     time.Minute,
+		SpillMaxBindingBytes:   100 * 1024 * 1024,
+		SpillMaxTotalBytes:     1024 * 1024 * 1024,
+		RetryStrategy:          "exponential",
 	}
 
 	err := envstruct.Load(&cfg)
@@ -58,6 +82,10 @@ func LoadConfig() *Config {
 		log.Fatalf("failed to load config from environment: %s", err)
 	}
 
+	if _, ok := egress.RetryStrategies[cfg.RetryStrategy]; !ok {
+		log.Fatalf("unknown retry strategy %q", cfg.RetryStrategy)
+	}
+
 	cfg.LogsAPIAddrWithAZ, err = idna.ToASCII(cfg.LogsAPIAddrWithAZ)
 	if err != nil {
 		log.Fatalf("failed to IDN encode LogAPIAddrWithAZ %s", err)
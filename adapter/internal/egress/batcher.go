@@ -0,0 +1,188 @@
+package egress
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// batchCloseTimeout is how long closing a batcher may take to send the
+// pending messages once the binding context is done.
+const batchCloseTimeout = 5 * time.Second
+
+// batchBuffer holds the pending messages of a batching writer in the request
+// format of its drain. Its methods are only called with the mutex of the
+// batcher held.
+type batchBuffer interface {
+	// add appends the messages of the envelope.
+	add(env *loggregator_v2.Envelope) error
+
+	// pending returns the number of pending messages and their size in
+	// bytes.
+	pending() (count, size int)
+
+	// send posts the pending messages and removes the ones that are done
+	// with. If messages are kept to be sent again an error is returned.
+	send(ctx context.Context) error
+
+	// reset discards the pending messages.
+	reset()
+}
+
+// batcher gathers the messages of a drain into batches which are sent when
+// they reach the batch size or when the oldest message has waited for the
+// batch delay. If sending a batch fails the error is returned and the batch
+// is kept. A subsequent write of the same envelope, as done by the
+// RetryWriter, retries the batch. Writing a different envelope after a
+// failure discards the failed batch, which is reported as dropped. Batches
+// are sent with the context of the binding.
+type batcher struct {
+	buf     batchBuffer
+	binding *URLBinding
+	size    int
+	delay   time.Duration
+
+	mu        sync.Mutex
+	start     time.Time
+	failedEnv *loggregator_v2.Envelope
+	done      chan struct{}
+}
+
+func newBatcher(buf batchBuffer, binding *URLBinding, size int, delay time.Duration) *batcher {
+	b := &batcher{
+		buf:     buf,
+		binding: binding,
+		size:    size,
+		delay:   delay,
+		done:    make(chan struct{}),
+	}
+	go b.flushOnDelay()
+
+	return b
+}
+
+func (b *batcher) write(env *loggregator_v2.Envelope) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if env != b.failedEnv {
+		if b.failedEnv != nil {
+			count, _ := b.buf.pending()
+			log.Printf("dropping batch of %d messages for %s drain %s", count, b.binding.Scheme(), b.binding.URL.Host)
+			b.binding.reportDropped(count)
+			b.buf.reset()
+			b.failedEnv = nil
+		}
+
+		if count, _ := b.buf.pending(); count == 0 {
+			b.start = time.Now()
+		}
+		if err := b.buf.add(env); err != nil {
+			return err
+		}
+
+		if !b.ready() {
+			return nil
+		}
+	}
+
+	if err := b.buf.send(b.binding.ctx()); err != nil {
+		b.failedEnv = env
+		return err
+	}
+	b.failedEnv = nil
+
+	return nil
+}
+
+// close stops the delayed flushing and sends any pending messages. Sending
+// is given up batchCloseTimeout after the binding context is done, in which
+// case the messages are reported as dropped.
+func (b *batcher) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return nil
+	default:
+		close(b.done)
+	}
+
+	count, _ := b.buf.pending()
+	if count == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-b.binding.ctx().Done():
+		case <-ctx.Done():
+			return
+		}
+
+		t := time.NewTimer(batchCloseTimeout)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := b.buf.send(ctx)
+	if err != nil {
+		count, _ = b.buf.pending()
+		log.Printf("dropping batch of %d messages for %s drain %s: %s", count, b.binding.Scheme(), b.binding.URL.Host, err)
+		b.binding.reportDropped(count)
+		b.buf.reset()
+	}
+
+	return err
+}
+
+func (b *batcher) ready() bool {
+	count, size := b.buf.pending()
+	if count == 0 {
+		return false
+	}
+
+	return size >= b.size || time.Since(b.start) >= b.delay
+}
+
+// flushOnDelay makes sure batches are sent even when no further envelopes
+// arrive for the drain.
+func (b *batcher) flushOnDelay() {
+	interval := b.delay / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-t.C:
+		}
+
+		b.mu.Lock()
+		// A batch that failed in write is retried by the next call to
+		// write. One that fails here is not, since no write may follow.
+		if b.failedEnv == nil && b.ready() {
+			if err := b.buf.send(b.binding.ctx()); err != nil {
+				count, _ := b.buf.pending()
+				log.Printf("dropping batch of %d messages for %s drain %s: %s", count, b.binding.Scheme(), b.binding.URL.Host, err)
+				b.binding.reportDropped(count)
+				b.buf.reset()
+			}
+		}
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,387 @@
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator"
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// ErrCircuitOpen is returned by a CircuitBreaker that is dropping envelopes
+// because its drain keeps failing.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every write through to the drain.
+	BreakerClosed BreakerState = iota
+
+	// BreakerHalfOpen lets a single probe write through to find out if the
+	// drain has recovered.
+	BreakerHalfOpen
+
+	// BreakerOpen drops every write without contacting the drain.
+	BreakerOpen
+)
+
+// String returns the name of the state as reported on the health endpoint.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// GaugeMetricClient creates gauge metrics.
+type GaugeMetricClient interface {
+	NewGaugeMetric(string, string, ...pulseemitter.MetricOption) pulseemitter.GaugeMetric
+}
+
+// HealthReporter adds details to the health endpoint.
+type HealthReporter interface {
+	SetDetail(name string, v interface{})
+}
+
+// CircuitBreakerWrapper wraps a WriterConstructor so that every writer trips
+// open after failureThreshold consecutive failed writes. An open breaker
+// drops envelopes until openTimeout has passed and then lets a single probe
+// through. A failureThreshold of zero disables the circuit breaker.
+func CircuitBreakerWrapper(
+	wc WriterConstructor,
+	failureThreshold int,
+	openTimeout time.Duration,
+	reporter *CircuitBreakerReporter,
+) WriterConstructor {
+	if failureThreshold <= 0 {
+		return wc
+	}
+
+	return WriterConstructor(func(
+		binding *URLBinding,
+		netConf NetworkTimeoutConfig,
+		skipCertVerify bool,
+		egressMetric pulseemitter.CounterMetric,
+	) WriteCloser {
+		writer := wc(
+			binding,
+			netConf,
+			skipCertVerify,
+			egressMetric,
+		)
+
+		return &CircuitBreaker{
+			writer:           writer,
+			binding:          binding,
+			id:               reporter.register(),
+			failureThreshold: failureThreshold,
+			openTimeout:      openTimeout,
+			reporter:         reporter,
+		}
+	})
+}
+
+// CircuitBreaker wraps a WriteCloser and stops writing to it while the drain
+// is failing.
+type CircuitBreaker struct {
+	writer           WriteCloser
+	binding          *URLBinding
+	id               int
+	failureThreshold int
+	openTimeout      time.Duration
+	reporter         *CircuitBreakerReporter
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+// Write delegates to the wrapped writer unless the breaker is open, in which
+// case ErrCircuitOpen is returned. The caller decides whether the envelope is
+// dropped or kept for later.
+func (b *CircuitBreaker) Write(e *loggregator_v2.Envelope) error {
+	if !b.allow() {
+		return ErrCircuitOpen
+	}
+
+	err := b.writer.Write(e)
+	b.record(err)
+
+	return err
+}
+
+// Close stops reporting the breaker and delegates to the wrapped writer.
+func (b *CircuitBreaker) Close() error {
+	b.reporter.remove(b.binding, b.id)
+
+	return b.writer.Close()
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// refusing reports whether the breaker is open and not yet ready to send a
+// probe.
+func (b *CircuitBreaker) refusing() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == BreakerOpen && time.Since(b.openedAt) < b.openTimeout
+}
+
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerOpen {
+		return true
+	}
+
+	if time.Since(b.openedAt) < b.openTimeout {
+		return false
+	}
+
+	b.setState(BreakerHalfOpen)
+
+	return true
+}
+
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			log.Printf("circuit breaker closed for %s", b.binding.URL.Host)
+			b.setState(BreakerClosed)
+		}
+
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.failureThreshold {
+		if b.state == BreakerClosed {
+			log.Printf("circuit breaker opened for %s after %d failures, err: %s", b.binding.URL.Host, b.failures, err)
+			b.reporter.emitOpenLog(b.binding, b.openTimeout)
+		}
+
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// setState must be called with the mutex held.
+func (b *CircuitBreaker) setState(s BreakerState) {
+	b.state = s
+	b.reporter.set(b.binding, b.id, s)
+}
+
+// circuitOpen reports whether the writer is, or wraps, a circuit breaker
+// that is currently refusing writes.
+func circuitOpen(w Writer) bool {
+	b := circuitBreaker(w)
+
+	return b != nil && b.refusing()
+}
+
+// circuitDropped counts an envelope that the circuit breaker of the writer
+// refused and that was discarded.
+func circuitDropped(w Writer) {
+	if b := circuitBreaker(w); b != nil {
+		b.reporter.dropped()
+	}
+}
+
+// circuitBreaker returns the circuit breaker the writer is or wraps.
+func circuitBreaker(w Writer) *CircuitBreaker {
+	switch w := w.(type) {
+	case *CircuitBreaker:
+		return w
+	case *RetryWriter:
+		return circuitBreaker(w.writer)
+	case *connectionMetricWriter:
+		return circuitBreaker(w.WriteCloser)
+	default:
+		return nil
+	}
+}
+
+// CircuitBreakerReporter exposes the state of every circuit breaker as a
+// gauge metric and on the health endpoint. A nil reporter reports nothing.
+type CircuitBreakerReporter struct {
+	metricClient  GaugeMetricClient
+	health        HealthReporter
+	droppedMetric pulseemitter.CounterMetric
+	logClient     LogClient
+	sourceIndex   string
+
+	mu     sync.Mutex
+	nextID int
+	gauges map[string]pulseemitter.GaugeMetric
+	states map[string]BreakerState
+}
+
+// NewCircuitBreakerReporter returns a CircuitBreakerReporter. The dropped
+// metric is incremented for every envelope dropped by an open breaker.
+func NewCircuitBreakerReporter(
+	metricClient GaugeMetricClient,
+	health HealthReporter,
+	droppedMetric pulseemitter.CounterMetric,
+	logClient LogClient,
+	sourceIndex string,
+) *CircuitBreakerReporter {
+	return &CircuitBreakerReporter{
+		metricClient:  metricClient,
+		health:        health,
+		droppedMetric: droppedMetric,
+		logClient:     logClient,
+		sourceIndex:   sourceIndex,
+		gauges:        make(map[string]pulseemitter.GaugeMetric),
+		states:        make(map[string]BreakerState),
+	}
+}
+
+func (r *CircuitBreakerReporter) dropped() {
+	if r == nil || r.droppedMetric == nil {
+		return
+	}
+
+	r.droppedMetric.Increment(1)
+}
+
+func (r *CircuitBreakerReporter) emitOpenLog(b *URLBinding, openTimeout time.Duration) {
+	if r == nil || r.logClient == nil {
+		return
+	}
+
+	option := loggregator.WithAppInfo(b.AppID, "LGR", r.sourceIndex)
+	msg := fmt.Sprintf("Syslog Drain: Drain keeps failing. Dropping messages for %s.", openTimeout)
+	r.logClient.EmitLog(msg, option)
+}
+
+// register returns the id of a new breaker. Every breaker is reported on
+// its own since a binding has one breaker per connection and several
+// bindings of an app may drain to the same host.
+func (r *CircuitBreakerReporter) register() int {
+	if r == nil {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+
+	return r.nextID
+}
+
+// set records the state of a breaker of the binding. Gauges are only
+// created once a breaker leaves the closed state so that healthy drains do
+// not add metrics.
+func (r *CircuitBreakerReporter) set(b *URLBinding, id int, s BreakerState) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := breakerKey(b, id)
+	gauge, ok := r.gauges[key]
+	if !ok && s != BreakerClosed && r.metricClient != nil {
+		// metric-documentation-v2: (adapter.circuit_breaker_state) State of
+		// a circuit breaker of a drain. 0 is closed, 1 is half-open and 2
+		// is open. The breaker tag tells apart the breakers of the parallel
+		// connections of a drain.
+		gauge = r.metricClient.NewGaugeMetric(
+			"circuit_breaker_state",
+			"state",
+			pulseemitter.WithVersion(2, 0),
+			pulseemitter.WithTags(map[string]string{
+				"app_id":  b.AppID,
+				"drain":   breakerDrain(b),
+				"breaker": strconv.Itoa(id),
+			}),
+		)
+		r.gauges[key] = gauge
+	}
+	if gauge != nil {
+		gauge.Set(float64(s))
+	}
+
+	if s == BreakerClosed {
+		delete(r.states, key)
+	} else {
+		r.states[key] = s
+	}
+	r.reportHealth()
+}
+
+// remove stops reporting a breaker of the binding. Its gauge is set to
+// closed before it is dropped.
+func (r *CircuitBreakerReporter) remove(b *URLBinding, id int) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := breakerKey(b, id)
+	if gauge, ok := r.gauges[key]; ok {
+		gauge.Set(float64(BreakerClosed))
+		delete(r.gauges, key)
+	}
+	delete(r.states, key)
+	r.reportHealth()
+}
+
+// reportHealth must be called with the mutex held.
+func (r *CircuitBreakerReporter) reportHealth() {
+	if r.health == nil {
+		return
+	}
+
+	if len(r.states) == 0 {
+		r.health.SetDetail("circuitBreakers", nil)
+		return
+	}
+
+	states := make(map[string]string, len(r.states))
+	for k, s := range r.states {
+		states[k] = s.String()
+	}
+	r.health.SetDetail("circuitBreakers", states)
+}
+
+// breakerKey identifies a breaker on the health endpoint.
+func breakerKey(b *URLBinding, id int) string {
+	return fmt.Sprintf("%s %s #%d", b.AppID, breakerDrain(b), id)
+}
+
+// breakerDrain describes the drain of a binding without exposing
+// credentials or query parameters of the drain URL.
+func breakerDrain(b *URLBinding) string {
+	return b.URL.Scheme + "://" + b.URL.Host + b.URL.Path
+}
@@ -0,0 +1,70 @@
+package egress
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// MaxConnections is the most parallel connections a binding may open.
+const MaxConnections = 16
+
+// connectionsFromURL reads the connections query parameter of syslog and
+// syslog-tls drains. Other drains, and drains with an invalid value, use a
+// single connection. Values above MaxConnections are lowered to it.
+func connectionsFromURL(b *URLBinding) int {
+	switch b.Scheme() {
+	case "syslog", "syslog-tls":
+	default:
+		return 1
+	}
+
+	n, err := strconv.Atoi(b.URL.Query().Get("connections"))
+	if err != nil || n < 1 {
+		return 1
+	}
+	if n > MaxConnections {
+		return MaxConnections
+	}
+
+	return n
+}
+
+// shardedWriter spreads envelopes over the writers of parallel connections.
+// Envelopes of the same source instance always go to the same writer so that
+// their order is kept.
+type shardedWriter struct {
+	writers []Writer
+}
+
+func newShardedWriter(writers []Writer) *shardedWriter {
+	return &shardedWriter{writers: writers}
+}
+
+func (s *shardedWriter) Write(env *loggregator_v2.Envelope) error {
+	h := fnv.New32a()
+	h.Write([]byte(env.GetSourceId()))
+	h.Write([]byte{0})
+	h.Write([]byte(env.GetTags()["source_type"]))
+	h.Write([]byte{0})
+	h.Write([]byte(env.GetInstanceId()))
+
+	return s.writers[h.Sum32()%uint32(len(s.writers))].Write(env)
+}
+
+// connectionMetricWriter counts the envelopes written by one connection.
+type connectionMetricWriter struct {
+	WriteCloser
+	metric pulseemitter.CounterMetric
+}
+
+func (w *connectionMetricWriter) Write(env *loggregator_v2.Envelope) error {
+	err := w.WriteCloser.Write(env)
+	if err == nil {
+		w.metric.Increment(1)
+	}
+
+	return err
+}
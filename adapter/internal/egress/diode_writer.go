@@ -1,6 +1,10 @@
 package egress
 
 import (
+	"log"
+	"sync/atomic"
+	"time"
+
 	"golang.org/x/net/context"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
@@ -13,34 +17,89 @@ type WaitGroup interface {
 	Done()
 }
 
+// diodeSize is the number of envelopes buffered in memory for each binding.
+const diodeSize = 10000
+
+// spillPollInterval is how long the writer waits when there is nothing in
+// memory or on disk.
+const spillPollInterval = 10 * time.Millisecond
+
 type DiodeWriter struct {
-	wc    WriteCloser
-	diode *diodes.OneToOne
-	wg    WaitGroup
+	wc      WriteCloser
+	diode   *diodes.OneToOne
+	wg      WaitGroup
+	alerter gendiodes.Alerter
+
+	// spill takes the envelopes that do not fit into the diode. The number
+	// of envelopes in the diode is tracked so that it never overwrites.
+	spill   *SpillQueue
+	pending int64
 
 	ctx context.Context
 }
 
+// DiodeWriterOption configures a DiodeWriter.
+type DiodeWriterOption func(*DiodeWriter)
+
+// WithSpillQueue makes the DiodeWriter write envelopes that do not fit into
+// memory to the given queue instead of dropping them. The queue is replayed
+// in order and closed when the writer stops.
+func WithSpillQueue(q *SpillQueue) DiodeWriterOption {
+	return func(d *DiodeWriter) {
+		d.spill = q
+	}
+}
+
 func NewDiodeWriter(
 	ctx context.Context,
 	wc WriteCloser,
 	alerter gendiodes.Alerter,
 	wg WaitGroup,
+	opts ...DiodeWriterOption,
 ) *DiodeWriter {
 	dw := &DiodeWriter{
-		wc:    wc,
-		diode: diodes.NewOneToOne(10000, alerter, gendiodes.WithPollingContext(ctx)),
-		wg:    wg,
-		ctx:   ctx,
+		wc:      wc,
+		diode:   diodes.NewOneToOne(diodeSize, alerter, gendiodes.WithPollingContext(ctx)),
+		wg:      wg,
+		alerter: alerter,
+		ctx:     ctx,
+	}
+	for _, o := range opts {
+		o(dw)
 	}
+
 	wg.Add(1)
-	go dw.start()
+	if dw.spill != nil {
+		go dw.startWithSpill()
+	} else {
+		go dw.start()
+	}
 
 	return dw
 }
 
-// Write writes an envelope into the diode. This can not fail.
+// Write writes an envelope into the diode. This can not fail. When a spill
+// queue is set, envelopes go to disk once the diode is full and keep going
+// there until the disk is replayed so that order is kept. Envelopes are only
+// dropped when the disk quota is exhausted as well.
 func (d *DiodeWriter) Write(env *loggregator_v2.Envelope) error {
+	if d.spill == nil {
+		d.diode.Set(env)
+		return nil
+	}
+
+	if atomic.LoadInt64(&d.pending) >= diodeSize || !d.spill.Empty() {
+		if err := d.spill.Append(env); err != nil {
+			if err != ErrSpillFull {
+				log.Printf("failed to spill envelope to disk: %s", err)
+			}
+			d.alerter.Alert(1)
+		}
+
+		return nil
+	}
+
+	atomic.AddInt64(&d.pending, 1)
 	d.diode.Set(env)
 
 	return nil
@@ -57,12 +116,94 @@ func (d *DiodeWriter) start() {
 		}
 
 		err := d.wc.Write(e)
+		if err == ErrCircuitOpen {
+			circuitDropped(d.wc)
+		}
 		if err != nil && contextDone(d.ctx) {
 			return
 		}
 	}
 }
 
+// startWithSpill writes envelopes from memory first and then from disk.
+// Disk only holds envelopes that arrived after the ones in memory. While the
+// drain's circuit breaker is open nothing is written, so envelopes pile up
+// in memory and then on disk instead of being dropped. When the context is
+// done the remaining envelopes in memory are written. If that fails they are
+// saved in front of the disk queue for the next run.
+func (d *DiodeWriter) startWithSpill() {
+	defer d.wc.Close()
+	defer d.wg.Done()
+	defer d.spill.Close()
+
+	for {
+		if circuitOpen(d.wc) {
+			if contextDone(d.ctx) {
+				d.saveRemaining()
+				return
+			}
+
+			time.Sleep(spillPollInterval)
+			continue
+		}
+
+		if e, ok := d.diode.TryNext(); ok {
+			atomic.AddInt64(&d.pending, -1)
+
+			err := d.wc.Write(e)
+			if err == ErrCircuitOpen || (err != nil && contextDone(d.ctx)) {
+				d.saveRemaining(e)
+			}
+			if err != nil && contextDone(d.ctx) {
+				return
+			}
+
+			continue
+		}
+
+		if contextDone(d.ctx) {
+			return
+		}
+
+		e, err := d.spill.Next()
+		if err != nil {
+			log.Printf("failed to read spilled envelope: %s", err)
+		}
+		if e == nil {
+			time.Sleep(spillPollInterval)
+			continue
+		}
+
+		err = d.wc.Write(e)
+		if err == ErrCircuitOpen || (err != nil && contextDone(d.ctx)) {
+			// Leave the envelope on disk to be written later.
+			continue
+		}
+		d.spill.Ack()
+	}
+}
+
+// saveRemaining moves the given envelopes and everything left in memory to
+// the front of the spill queue.
+func (d *DiodeWriter) saveRemaining(envs ...*loggregator_v2.Envelope) {
+	for {
+		e, ok := d.diode.TryNext()
+		if !ok {
+			break
+		}
+		atomic.AddInt64(&d.pending, -1)
+		envs = append(envs, e)
+	}
+
+	missed, err := d.spill.Prepend(envs)
+	if err != nil && err != ErrSpillFull {
+		log.Printf("failed to spill envelopes to disk: %s", err)
+	}
+	if missed > 0 {
+		d.alerter.Alert(missed)
+	}
+}
+
 func contextDone(ctx context.Context) bool {
 	select {
 	case <-ctx.Done():
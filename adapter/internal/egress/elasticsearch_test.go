@@ -0,0 +1,212 @@
+package egress_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
+	"code.cloudfoundry.org/scalable-syslog/internal/testhelper"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ElasticsearchWriter", func() {
+	var (
+		bulk    *spyBulkEndpoint
+		metric  *testhelper.SpyMetric
+		netConf = egress.NetworkTimeoutConfig{}
+	)
+
+	BeforeEach(func() {
+		bulk = newSpyBulkEndpoint()
+		metric = &testhelper.SpyMetric{}
+	})
+
+	AfterEach(func() {
+		bulk.Close()
+	})
+
+	newWriter := func(query string) egress.WriteCloser {
+		u := strings.Replace(bulk.URL, "https://", "elasticsearch://user:pass@", 1) + "?" + query
+		b := buildURLBinding(u, "Test-App-ID", "test-hostname")
+
+		return egress.ElasticsearchWriterConstructor(nil)(b, netConf, true, metric)
+	}
+
+	It("sends documents to the bulk API", func() {
+		writer := newWriter("")
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		env.Timestamp = 1500000000000000000
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		reqs := bulk.requests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].path).To(Equal("/_bulk"))
+		Expect(reqs[0].header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+		user, pass, ok := (&http.Request{Header: reqs[0].header}).BasicAuth()
+		Expect(ok).To(BeTrue())
+		Expect(user).To(Equal("user"))
+		Expect(pass).To(Equal("pass"))
+
+		lines := bytes.Split(bytes.TrimSuffix(reqs[0].body, []byte("\n")), []byte("\n"))
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(MatchJSON(`{"create": {"_index": "logs-test-app-id-2017.07.14"}}`))
+		Expect(lines[1]).To(MatchJSON(`{
+			"@timestamp": "2017-07-14T02:40:00Z",
+			"timestamp": "2017-07-14T02:40:00Z",
+			"app_id": "Test-App-ID",
+			"hostname": "test-hostname",
+			"process_id": "[APP/1]",
+			"instance": "1",
+			"log_type": "OUT",
+			"message": "just a test",
+			"tags": {"source_type": "APP"}
+		}`))
+		Expect(metric.Delta()).To(Equal(uint64(1)))
+	})
+
+	It("renders the index template", func() {
+		writer := newWriter("index=cf-{hostname}-{yyyy.MM}")
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		env.Timestamp = 1500000000000000000
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		line := bytes.SplitN(bulk.requests()[0].body, []byte("\n"), 2)[0]
+		Expect(line).To(MatchJSON(`{"create": {"_index": "cf-test-hostname-2017.07"}}`))
+	})
+
+	It("only retries the documents that failed with a retryable status", func() {
+		bulk.statuses = [][]int{{201, 429, 400, 503, 201}}
+		writer := newWriter("batch-size=1")
+
+		env := buildGaugeEnvelope("1")
+		Expect(writer.Write(env)).To(MatchError(ContainSubstring("2 of 5 documents failed")))
+		Expect(metric.Delta()).To(Equal(uint64(2)))
+
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(metric.Delta()).To(Equal(uint64(4)))
+
+		reqs := bulk.requests()
+		Expect(reqs).To(HaveLen(2))
+		first := bulkGauges(reqs[0])
+		Expect(bulkGauges(reqs[1])).To(Equal([]string{first[1], first[3]}))
+	})
+
+	It("reports rejected and discarded documents as dropped", func() {
+		bulk.statuses = [][]int{{201, 429, 400, 503, 201}}
+		droppedMetric := &testhelper.SpyMetric{}
+		logClient := newSpyLogClient()
+		connector := egress.NewSyslogConnector(
+			netConf,
+			true,
+			&SpyWaitGroup{},
+			egress.WithConstructors(map[string]egress.WriterConstructor{
+				"elasticsearch": egress.ElasticsearchWriterConstructor(nil),
+			}),
+			egress.WithEgressMetrics(map[string]pulseemitter.CounterMetric{
+				"elasticsearch": metric,
+			}),
+			egress.WithDroppedMetrics(map[string]pulseemitter.CounterMetric{
+				"elasticsearch": droppedMetric,
+			}),
+			egress.WithLogClient(logClient, "3"),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		writer, err := connector.Connect(ctx, &v1.Binding{
+			AppId: "app-id",
+			Drain: strings.Replace(bulk.URL, "https://", "elasticsearch://", 1) + "?batch-size=1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(writer.Write(buildGaugeEnvelope("1"))).To(Succeed())
+		Eventually(bulk.requests).Should(HaveLen(1))
+		Expect(writer.Write(buildGaugeEnvelope("2"))).To(Succeed())
+
+		Eventually(bulk.requests).Should(HaveLen(2))
+		Eventually(droppedMetric.Delta).Should(Equal(uint64(3)))
+		Expect(logClient.message()).To(ContainElements(
+			"1 messages lost in user provided syslog drain",
+			"2 messages lost in user provided syslog drain",
+		))
+	})
+
+	It("returns an error when the request fails", func() {
+		bulk.status = http.StatusServiceUnavailable
+		writer := newWriter("batch-size=1")
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(MatchError(ContainSubstring("503")))
+	})
+})
+
+// bulkGauges returns the gauge names of the documents in the request.
+func bulkGauges(r spyHTTPRequest) []string {
+	var names []string
+	lines := bytes.Split(bytes.TrimSuffix(r.body, []byte("\n")), []byte("\n"))
+	for i := 1; i < len(lines); i += 2 {
+		var doc struct {
+			Gauge struct {
+				Name string `json:"name"`
+			} `json:"gauge"`
+		}
+		Expect(json.Unmarshal(lines[i], &doc)).To(Succeed())
+		names = append(names, doc.Gauge.Name)
+	}
+
+	return names
+}
+
+type spyBulkEndpoint struct {
+	*spyHTTPServer
+
+	status   int
+	statuses [][]int
+}
+
+// newSpyBulkEndpoint returns a fake bulk API. Each request is answered with
+// the next list of item statuses, or with success for every item.
+func newSpyBulkEndpoint() *spyBulkEndpoint {
+	e := &spyBulkEndpoint{status: http.StatusOK}
+	e.spyHTTPServer = newSpyHTTPServer(func(w http.ResponseWriter, r spyHTTPRequest) {
+		if e.status != http.StatusOK {
+			w.WriteHeader(e.status)
+			return
+		}
+
+		count := bytes.Count(r.body, []byte("\n")) / 2
+		statuses := make([]int, count)
+		for i := range statuses {
+			statuses[i] = http.StatusCreated
+		}
+		if len(e.statuses) > 0 {
+			statuses, e.statuses = e.statuses[0], e.statuses[1:]
+		}
+
+		resp := map[string]interface{}{"errors": false}
+		var items []interface{}
+		for _, s := range statuses {
+			item := map[string]interface{}{"status": s}
+			if s >= 300 {
+				resp["errors"] = true
+				item["error"] = map[string]string{"type": "some_error", "reason": "some reason"}
+			}
+			items = append(items, map[string]interface{}{"create": item})
+		}
+		resp["items"] = items
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	return e
+}
@@ -0,0 +1,59 @@
+package egress
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+)
+
+// framing describes how syslog messages are delimited when written to a
+// stream. See RFC 6587.
+type framing int
+
+const (
+	// octetCountingFraming prefixes each message with its length followed by
+	// a space. This is the default.
+	octetCountingFraming framing = iota
+
+	// lfFraming terminates each message with a line feed
+	// (non-transparent-framing). Line feeds inside a message are escaped as
+	// #012, the way rsyslog escapes control characters, so that joined
+	// multiline messages are not split by the receiver.
+	lfFraming
+
+	// nulFraming terminates each message with a NUL byte.
+	nulFraming
+)
+
+// framingFromURL reads the framing query parameter from a drain URL. Unknown
+// values fall back to octet counting. The scheduler rejects drains with
+// unknown values before they reach the adapter.
+func framingFromURL(u *url.URL) framing {
+	switch u.Query().Get("framing") {
+	case "lf":
+		return lfFraming
+	case "nul":
+		return nulFraming
+	default:
+		return octetCountingFraming
+	}
+}
+
+// frame wraps a marshaled syslog message according to the framing.
+func (f framing) frame(msg []byte) []byte {
+	switch f {
+	case lfFraming:
+		msg = bytes.TrimSuffix(msg, []byte("\n"))
+		msg = bytes.Replace(msg, []byte("\n"), []byte("#012"), -1)
+
+		return append(msg, '\n')
+	case nulFraming:
+		return append(msg, 0)
+	default:
+		b := bytes.NewBuffer(make([]byte, 0, len(msg)+8))
+		fmt.Fprintf(b, "%d ", len(msg))
+		b.Write(msg)
+
+		return b.Bytes()
+	}
+}
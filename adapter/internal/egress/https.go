@@ -2,84 +2,481 @@ package egress
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/pulseemitter"
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
-	"code.cloudfoundry.org/scalable-syslog/internal/api"
 )
 
+const (
+	defaultHTTPSBatchSize  = 256 * 1024
+	defaultHTTPSBatchDelay = time.Second
+
+	// defaultCompressMinSize is the smallest request body that is compressed.
+	// Compressing smaller bodies rarely saves enough to be worth the CPU.
+	defaultCompressMinSize = 1024
+)
+
+// Formats supported by HTTPS drains.
+const (
+	rfc5424Format = "rfc5424"
+	jsonFormat    = "json"
+	ndjsonFormat  = "ndjson"
+
+	// hecFormat is used by Splunk drains. It cannot be selected with the
+	// format query parameter.
+	hecFormat = "hec"
+)
+
+// HTTPSWriter posts syslog messages to an HTTPS drain. By default every
+// message is sent in its own request. When batching is enabled messages are
+// gathered into a single request body which is flushed when it reaches the
+// batch size or when the oldest message has waited for the batch delay.
+// Request bodies are compressed when the drain URL sets compress=gzip or
+// compress=deflate and the body is at least compress-min-size bytes.
+// Messages are sent as RFC 5424 text unless the drain URL sets
+// format=rfc3164, which sends RFC 3164 text, format=json, which sends one
+// JSON object per message and a JSON array per batch, or format=ndjson,
+// which sends newline delimited JSON objects.
 type HTTPSWriter struct {
 	hostname     string
 	appID        string
+	binding      *URLBinding
 	url          *url.URL
+	endpoint     string
+	header       http.Header
 	client       *http.Client
 	egressMetric pulseemitter.CounterMetric
+
+	// checkResponse inspects the body of successful responses to requests
+	// carrying count messages. It is used by drains that report errors in
+	// the body.
+	checkResponse func(w *HTTPSWriter, body []byte, count int) error
+
+	hec *hecSettings
+
+	batchSize  int
+	batchDelay time.Duration
+	framing    framing
+	format     string
+	formatter  syslogFormatter
+	tags       *tagFilter
+
+	compression       string
+	compressMinSize   int
+	uncompressedBytes pulseemitter.CounterMetric
+	compressedBytes   pulseemitter.CounterMetric
+
+	tlsConfig *tls.Config
+	tlsErr    error
+
+	batcher    *batcher
+	batch      bytes.Buffer
+	batchCount int
 }
 
-func NewHTTPSWriter(
+// HTTPSOption configures the writers created by HTTPSWriterConstructor.
+type HTTPSOption func(*HTTPSWriter)
+
+// WithHTTPSBatching sets the default batch size in bytes and the maximum time
+// a message waits in a batch. Drains can override either value with the
+// batch-size and batch-delay query parameters. A size and delay of zero
+// disables batching.
+func WithHTTPSBatching(size int, delay time.Duration) HTTPSOption {
+	return func(w *HTTPSWriter) {
+		w.batchSize = size
+		w.batchDelay = delay
+	}
+}
+
+// WithHTTPSByteMetrics sets the metrics that count request body bytes before
+// and after compression.
+func WithHTTPSByteMetrics(uncompressed, compressed pulseemitter.CounterMetric) HTTPSOption {
+	return func(w *HTTPSWriter) {
+		w.uncompressedBytes = uncompressed
+		w.compressedBytes = compressed
+	}
+}
+
+// WithHTTPSTLSConfig sets the TLS config used to connect to drains. By
+// default api.NewTLSConfig is used.
+func WithHTTPSTLSConfig(c *tls.Config) HTTPSOption {
+	return func(w *HTTPSWriter) {
+		w.tlsConfig = c
+	}
+}
+
+// HTTPSWriterConstructor returns a WriterConstructor for HTTPS drains
+// configured with the given options.
+func HTTPSWriterConstructor(opts ...HTTPSOption) WriterConstructor {
+	return WriterConstructor(func(
+		binding *URLBinding,
+		netConf NetworkTimeoutConfig,
+		skipCertVerify bool,
+		egressMetric pulseemitter.CounterMetric,
+	) WriteCloser {
+		return newHTTPSWriter(binding, netConf, skipCertVerify, egressMetric, opts)
+	})
+}
+
+func newHTTPSWriter(
 	binding *URLBinding,
 	netConf NetworkTimeoutConfig,
 	skipCertVerify bool,
 	egressMetric pulseemitter.CounterMetric,
-) WriteCloser {
-
-	client := httpClient(netConf, skipCertVerify)
-
-	return &HTTPSWriter{
+	opts []HTTPSOption,
+) *HTTPSWriter {
+	w := &HTTPSWriter{
+		binding:      binding,
 		url:          binding.URL,
+		endpoint:     binding.URL.String(),
 		appID:        binding.AppID,
 		hostname:     binding.Hostname,
-		client:       client,
 		egressMetric: egressMetric,
+		framing:      httpsBatchFraming(binding.URL),
+		format:       httpsFormat(binding.URL),
+		formatter:    syslogFormatterFromURL(binding),
+		tags:         tagsFromURL(binding.URL),
+	}
+	w.compression, w.compressMinSize = httpsCompression(binding.URL)
+
+	for _, o := range opts {
+		o(w)
+	}
+
+	tlsConfig, err := drainTLSConfig(w.tlsConfig, binding, skipCertVerify)
+	if err != nil {
+		w.tlsErr = err
+		tlsConfig = nil
 	}
+	w.client = httpClient(netConf, tlsConfig, binding.proxy)
+	w.batchSize, w.batchDelay = httpsBatchSettings(binding.URL, w.batchSize, w.batchDelay)
+
+	if w.batchSize > 0 {
+		w.batcher = newBatcher(w, binding, w.batchSize, w.batchDelay)
+	}
+
+	return w
 }
 
+// NewHTTPSWriter creates a new HTTPS writer that only batches messages when
+// the drain URL asks for it.
+func NewHTTPSWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	skipCertVerify bool,
+	egressMetric pulseemitter.CounterMetric,
+) WriteCloser {
+	return HTTPSWriterConstructor()(binding, netConf, skipCertVerify, egressMetric)
+}
+
+// Write sends the envelope to the drain, or adds it to the current batch.
+// If flushing a batch fails the error is returned and the batch is kept. A
+// subsequent write of the same envelope, as done by the RetryWriter, retries
+// the whole batch. Writing a different envelope after a failure discards the
+// failed batch, which is reported as dropped.
 func (w *HTTPSWriter) Write(env *loggregator_v2.Envelope) error {
-	msgs := generateRFC5424Messages(env, w.hostname, w.appID)
-	for _, msg := range msgs {
-		b, err := msg.MarshalBinary()
+	if w.batcher == nil {
+		return w.writeEach(env)
+	}
+
+	return w.batcher.write(env)
+}
+
+// Close stops the delayed flushing and sends any pending messages.
+func (w *HTTPSWriter) Close() error {
+	if w.batcher == nil {
+		return nil
+	}
+
+	return w.batcher.close()
+}
+
+func (w *HTTPSWriter) writeEach(env *loggregator_v2.Envelope) error {
+	msgs, err := w.encode(env)
+	if err != nil {
+		return err
+	}
+
+	// The collector accepts several events in one request, so the events
+	// of an envelope are posted together.
+	if w.format == hecFormat && len(msgs) > 0 {
+		err = w.post(w.binding.ctx(), bytes.Join(msgs, []byte("\n")), len(msgs))
 		if err != nil {
 			return err
 		}
 
-		resp, err := w.client.Post(w.url.String(), "text/plain", bytes.NewBuffer(b))
+		w.egressMetric.Increment(uint64(len(msgs)))
+		return nil
+	}
+
+	for _, b := range msgs {
+		if w.format == ndjsonFormat {
+			b = append(b, '\n')
+		}
+
+		err = w.post(w.binding.ctx(), b, 1)
 		if err != nil {
 			return err
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode < 200 || resp.StatusCode > 299 {
-			return fmt.Errorf("Syslog Writer: Post responded with %d status code", resp.StatusCode)
+		w.egressMetric.Increment(1)
+	}
+
+	return nil
+}
+
+func (w *HTTPSWriter) add(env *loggregator_v2.Envelope) error {
+	msgs, err := w.encode(env)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range msgs {
+		switch w.format {
+		case jsonFormat:
+			if w.batchCount == 0 {
+				w.batch.WriteByte('[')
+			} else {
+				w.batch.WriteByte(',')
+			}
+			w.batch.Write(b)
+		case ndjsonFormat, hecFormat:
+			w.batch.Write(b)
+			w.batch.WriteByte('\n')
+		default:
+			w.batch.Write(w.framing.frame(b))
 		}
+		w.batchCount++
+	}
 
-		io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
 
-		w.egressMetric.Increment(1)
+// encode converts an envelope into the messages of the drain format.
+func (w *HTTPSWriter) encode(env *loggregator_v2.Envelope) ([][]byte, error) {
+	switch w.format {
+	case jsonFormat, ndjsonFormat:
+		return generateJSONMessages(env, w.hostname, w.appID, w.tags)
+	case hecFormat:
+		return generateHECMessages(env, w.hostname, w.appID, w.tags, w.hec)
+	}
+
+	return w.formatter.format(env)
+}
+
+func (w *HTTPSWriter) pending() (int, int) {
+	return w.batchCount, w.batch.Len()
+}
+
+// send posts the current batch.
+func (w *HTTPSWriter) send(ctx context.Context) error {
+	body := w.batch.Bytes()
+	if w.format == jsonFormat {
+		// The closing bracket is added to a copy since a failed batch is
+		// kept and may receive more messages.
+		body = append(body[:len(body):len(body)], ']')
 	}
 
+	err := w.post(ctx, body, w.batchCount)
+	if err != nil {
+		return err
+	}
+
+	w.egressMetric.Increment(uint64(w.batchCount))
+	w.reset()
+
 	return nil
 }
 
-func (*HTTPSWriter) Close() error {
+func (w *HTTPSWriter) reset() {
+	w.batch.Reset()
+	w.batchCount = 0
+}
+
+// post sends a request body carrying count messages.
+func (w *HTTPSWriter) post(ctx context.Context, body []byte, count int) error {
+	if w.tlsErr != nil {
+		return w.tlsErr
+	}
+
+	payload := body
+	compressed := w.compression != "" && len(body) >= w.compressMinSize
+	if compressed {
+		var err error
+		payload, err = compress(w.compression, body)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range w.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", httpsContentType(w.format))
+	if compressed {
+		req.Header.Set("Content-Encoding", w.compression)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Syslog Writer: Post responded with %d status code", resp.StatusCode)
+	}
+
+	if w.checkResponse != nil {
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+
+		if err := w.checkResponse(w, respBody, count); err != nil {
+			return err
+		}
+	} else {
+		io.Copy(ioutil.Discard, resp.Body)
+	}
+
+	if w.uncompressedBytes != nil {
+		w.uncompressedBytes.Increment(uint64(len(body)))
+	}
+	if w.compressedBytes != nil {
+		w.compressedBytes.Increment(uint64(len(payload)))
+	}
+
 	return nil
 }
 
-func httpClient(netConf NetworkTimeoutConfig, skipCertVerify bool) *http.Client {
-	tlsConfig := api.NewTLSConfig()
-	tlsConfig.InsecureSkipVerify = skipCertVerify
+func compress(encoding string, body []byte) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		zw  io.WriteCloser
+	)
+
+	switch encoding {
+	case "gzip":
+		zw = gzip.NewWriter(&buf)
+	case "deflate":
+		zw = zlib.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", encoding)
+	}
+
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// httpsCompression reads the compress and compress-min-size query parameters
+// of the drain URL. Only gzip and deflate are supported, anything else
+// disables compression.
+func httpsCompression(u *url.URL) (string, int) {
+	q := u.Query()
+
+	encoding := q.Get("compress")
+	switch encoding {
+	case "gzip", "deflate":
+	default:
+		return "", 0
+	}
+
+	minSize, err := strconv.Atoi(q.Get("compress-min-size"))
+	if err != nil || minSize < 0 {
+		minSize = defaultCompressMinSize
+	}
+
+	return encoding, minSize
+}
+
+// httpsBatchSettings applies the batch-size and batch-delay query parameters
+// of the drain URL on top of the given defaults. If only one of the two ends
+// up set the other falls back to a sensible default.
+func httpsBatchSettings(u *url.URL, size int, delay time.Duration) (int, time.Duration) {
+	q := u.Query()
+	if s, err := strconv.Atoi(q.Get("batch-size")); err == nil {
+		size = s
+	}
+	if d, err := time.ParseDuration(q.Get("batch-delay")); err == nil {
+		delay = d
+	}
 
+	if size <= 0 && delay <= 0 {
+		return 0, 0
+	}
+	if size <= 0 {
+		size = defaultHTTPSBatchSize
+	}
+	if delay <= 0 {
+		delay = defaultHTTPSBatchDelay
+	}
+
+	return size, delay
+}
+
+// httpsFormat reads the format query parameter of the drain URL. Unknown
+// values fall back to RFC 5424.
+func httpsFormat(u *url.URL) string {
+	switch f := u.Query().Get("format"); f {
+	case jsonFormat, ndjsonFormat, rfc3164Format:
+		return f
+	default:
+		return rfc5424Format
+	}
+}
+
+func httpsContentType(format string) string {
+	switch format {
+	case jsonFormat, hecFormat:
+		return "application/json"
+	case ndjsonFormat:
+		return "application/x-ndjson"
+	default:
+		return "text/plain"
+	}
+}
+
+// httpsBatchFraming returns the framing used to separate messages within a
+// batch. Unlike stream drains, batches are newline separated by default.
+func httpsBatchFraming(u *url.URL) framing {
+	if u.Query().Get("framing") == "" {
+		return lfFraming
+	}
+
+	return framingFromURL(u)
+}
+
+func httpClient(netConf NetworkTimeoutConfig, tlsConfig *tls.Config, p *Proxy) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   netConf.DialTimeout,
+		KeepAlive: netConf.Keepalive,
+	}
 	tr := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout:   netConf.DialTimeout,
-			KeepAlive: netConf.Keepalive,
-		}).DialContext,
+		DialContext:           p.dialContext(dialer, true),
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
@@ -1,17 +1,29 @@
 package egress_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/rfc5424"
 	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
 	"code.cloudfoundry.org/scalable-syslog/internal/testhelper"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
 )
 
 var _ = Describe("HTTPWriter", func() {
@@ -252,6 +264,406 @@ var _ = Describe("HTTPWriter", func() {
 		Expect(writer.Write(counterEnv)).To(Succeed())
 		Expect(writer.Write(logEnv)).To(Succeed())
 	})
+	Describe("compression", func() {
+		var (
+			env      = buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			expected = "<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/1] - - just a test\n"
+		)
+
+		DescribeTable("compresses request bodies", func(encoding string) {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?compress="+encoding+"&compress-min-size=10", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+
+			Expect(writer.Write(env)).To(Succeed())
+
+			Expect(drain.encodings()).To(Equal([]string{encoding}))
+			Expect(decompress(encoding, drain.bodies()[0])).To(Equal(expected))
+		},
+			Entry("gzip", "gzip"),
+			Entry("deflate", "deflate"),
+		)
+
+		It("does not compress bodies below the minimum size", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?compress=gzip", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+
+			Expect(writer.Write(env)).To(Succeed())
+
+			Expect(drain.encodings()).To(Equal([]string{""}))
+			Expect(string(drain.bodies()[0])).To(Equal(expected))
+		})
+
+		It("compresses whole batches", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?compress=gzip&batch-size=150&compress-min-size=100", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+			defer writer.Close()
+
+			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(env)).To(Succeed())
+
+			Expect(drain.encodings()).To(Equal([]string{"gzip"}))
+			Expect(decompress("gzip", drain.bodies()[0])).To(Equal(expected + expected))
+		})
+
+		It("ignores unknown compression", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?compress=brotli&compress-min-size=10", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+
+			Expect(writer.Write(env)).To(Succeed())
+
+			Expect(drain.encodings()).To(Equal([]string{""}))
+		})
+
+		It("emits byte metrics before and after compression", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			uncompressed := &testhelper.SpyMetric{}
+			compressed := &testhelper.SpyMetric{}
+			b := buildURLBinding(drain.URL+"?compress=gzip&compress-min-size=10", "test-app-id", "test-hostname")
+			constructor := egress.HTTPSWriterConstructor(
+				egress.WithHTTPSByteMetrics(uncompressed, compressed),
+			)
+			writer := constructor(b, netConf, true, &testhelper.SpyMetric{})
+
+			longEnv := buildLogEnvelope("APP", "1", strings.Repeat("a", 2000), loggregator_v2.Log_OUT)
+			Expect(writer.Write(longEnv)).To(Succeed())
+
+			Expect(uncompressed.Delta()).To(BeNumerically(">", 2000))
+			Expect(compressed.Delta()).To(Equal(uint64(len(drain.bodies()[0]))))
+			Expect(compressed.Delta()).To(BeNumerically("<", uncompressed.Delta()))
+		})
+	})
+
+	Describe("batching", func() {
+		It("sends messages in a single newline separated request when the batch size is reached", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?batch-size=200", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+			defer writer.Close()
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(env)).To(Succeed())
+			Expect(drain.bodies()).To(BeEmpty())
+			Expect(writer.Write(env)).To(Succeed())
+
+			Expect(drain.bodies()).To(HaveLen(1))
+			lines := bytes.Split(bytes.TrimSuffix(drain.bodies()[0], []byte("\n")), []byte("\n"))
+			Expect(lines).To(HaveLen(3))
+			for _, line := range lines {
+				msg := &rfc5424.Message{}
+				Expect(msg.UnmarshalBinary(line)).To(Succeed())
+				Expect(msg.ProcessID).To(Equal("[APP/1]"))
+			}
+		})
+
+		It("flushes the batch after the batch delay", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?batch-delay=50ms", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+			defer writer.Close()
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+			Expect(drain.bodies()).To(BeEmpty())
+
+			Eventually(drain.bodies).Should(HaveLen(1))
+		})
+
+		It("supports octet counting framing", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?batch-size=100&framing=octet", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+			defer writer.Close()
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(env)).To(Succeed())
+
+			Expect(drain.bodies()).To(HaveLen(1))
+			msg := "<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/1] - - just a test\n"
+			Expect(string(drain.bodies()[0])).To(Equal("89 " + msg + "89 " + msg))
+		})
+
+		It("uses the constructor defaults when the drain does not set any", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL, "test-app-id", "test-hostname")
+			constructor := egress.HTTPSWriterConstructor(
+				egress.WithHTTPSBatching(200, time.Hour),
+			)
+			writer := constructor(b, netConf, true, &testhelper.SpyMetric{})
+			defer writer.Close()
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			for i := 0; i < 3; i++ {
+				Expect(writer.Write(env)).To(Succeed())
+			}
+
+			Expect(drain.bodies()).To(HaveLen(1))
+		})
+
+		It("flushes pending messages on close", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?batch-size=10000", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(drain.bodies()).To(HaveLen(1))
+		})
+
+		It("gives up sending pending messages on close once the binding context is done", func() {
+			requests := make(chan struct{}, 1)
+			release := make(chan struct{})
+			drain := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests <- struct{}{}
+				<-release
+			}))
+			defer drain.Close()
+			defer close(release)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			b := buildURLBinding(drain.URL+"?batch-size=10000", "test-app-id", "test-hostname")
+			b.Context = ctx
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+			cancel()
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- writer.Close()
+			}()
+
+			Eventually(requests).Should(Receive())
+			Eventually(errs, 10).Should(Receive(HaveOccurred()))
+		})
+
+		It("emits an egress metric for each message in a batch", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			metric := &testhelper.SpyMetric{}
+			b := buildURLBinding(drain.URL+"?batch-size=200", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, metric)
+			defer writer.Close()
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			for i := 0; i < 3; i++ {
+				Expect(writer.Write(env)).To(Succeed())
+			}
+
+			Expect(metric.Delta()).To(Equal(uint64(3)))
+		})
+
+		It("retries the whole batch when the same envelope is written again", func() {
+			drain := newMockBatchDrain(http.StatusOK, 1)
+			b := buildURLBinding(drain.URL+"?batch-size=100", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+			defer writer.Close()
+
+			env1 := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			env2 := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env1)).To(Succeed())
+			Expect(writer.Write(env2)).To(HaveOccurred())
+			Expect(writer.Write(env2)).To(Succeed())
+
+			Expect(drain.bodies()).To(HaveLen(2))
+			Expect(drain.bodies()[1]).To(Equal(drain.bodies()[0]))
+			Expect(bytes.Count(drain.bodies()[1], []byte("\n"))).To(Equal(2))
+		})
+
+		It("reports a failed batch that is dropped", func() {
+			drain := newMockBatchDrain(http.StatusOK, 1)
+			droppedMetric := &testhelper.SpyMetric{}
+			logClient := newSpyLogClient()
+			connector := egress.NewSyslogConnector(
+				netConf,
+				true,
+				&SpyWaitGroup{},
+				egress.WithConstructors(map[string]egress.WriterConstructor{
+					"https": egress.HTTPSWriterConstructor(egress.WithHTTPSBatching(10, time.Hour)),
+				}),
+				egress.WithEgressMetrics(map[string]pulseemitter.CounterMetric{
+					"https": &testhelper.SpyMetric{},
+				}),
+				egress.WithDroppedMetrics(map[string]pulseemitter.CounterMetric{
+					"https": droppedMetric,
+				}),
+				egress.WithLogClient(logClient, "3"),
+			)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			writer, err := connector.Connect(ctx, &v1.Binding{AppId: "app-id", Drain: drain.URL})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+			Eventually(drain.bodies).Should(HaveLen(1))
+			Expect(writer.Write(buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+
+			Eventually(drain.bodies).Should(HaveLen(2))
+			Expect(droppedMetric.Delta()).To(Equal(uint64(1)))
+			Expect(logClient.message()).To(ContainElement("1 messages lost in user provided syslog drain"))
+		})
+
+		It("reports a batch that fails to flush after the batch delay as dropped", func() {
+			drain := newMockBatchDrain(http.StatusOK, 1)
+			droppedMetric := &testhelper.SpyMetric{}
+			logClient := newSpyLogClient()
+			connector := egress.NewSyslogConnector(
+				netConf,
+				true,
+				&SpyWaitGroup{},
+				egress.WithConstructors(map[string]egress.WriterConstructor{
+					"https": egress.HTTPSWriterConstructor(egress.WithHTTPSBatching(10000, 50*time.Millisecond)),
+				}),
+				egress.WithEgressMetrics(map[string]pulseemitter.CounterMetric{
+					"https": &testhelper.SpyMetric{},
+				}),
+				egress.WithDroppedMetrics(map[string]pulseemitter.CounterMetric{
+					"https": droppedMetric,
+				}),
+				egress.WithLogClient(logClient, "3"),
+			)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			writer, err := connector.Connect(ctx, &v1.Binding{AppId: "app-id", Drain: drain.URL})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT))).To(Succeed())
+
+			Eventually(droppedMetric.Delta).Should(Equal(uint64(1)))
+			Expect(logClient.message()).To(ContainElement("1 messages lost in user provided syslog drain"))
+			Consistently(drain.bodies).Should(HaveLen(1))
+		})
+
+		It("drops a failed batch once a new envelope is written", func() {
+			drain := newMockBatchDrain(http.StatusOK, 1)
+			b := buildURLBinding(drain.URL+"?batch-size=10", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+			defer writer.Close()
+
+			env1 := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			env2 := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env1)).To(HaveOccurred())
+			Expect(writer.Write(env2)).To(Succeed())
+
+			Expect(drain.bodies()).To(HaveLen(2))
+			Expect(string(drain.bodies()[1])).To(ContainSubstring("[APP/2]"))
+			Expect(string(drain.bodies()[1])).ToNot(ContainSubstring("[APP/1]"))
+		})
+	})
+
+	It("sends RFC 3164 messages with format=rfc3164", func() {
+		drain := newMockBatchDrain(http.StatusOK, 0)
+		b := buildURLBinding(drain.URL+"?format=rfc3164", "test-app-id", "test-hostname")
+		writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		Expect(drain.contentTypes()).To(Equal([]string{"text/plain"}))
+		Expect(string(drain.bodies()[0])).To(Equal("<14>Jan  1 00:00:00 test-hostname test-app-id[APP/1]: just a test\n"))
+	})
+
+	Describe("json format", func() {
+		It("sends a JSON object per message", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?format=json", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_ERR)
+			env.Tags["deployment"] = "cf"
+			Expect(writer.Write(env)).To(Succeed())
+
+			Expect(drain.contentTypes()).To(Equal([]string{"application/json"}))
+			Expect(drain.bodies()[0]).To(MatchJSON(`{
+				"timestamp": "1970-01-01T00:00:00.012345678Z",
+				"app_id": "test-app-id",
+				"hostname": "test-hostname",
+				"process_id": "[APP/1]",
+				"instance": "1",
+				"log_type": "ERR",
+				"message": "just a test",
+				"tags": {"source_type": "APP", "deployment": "cf"}
+			}`))
+		})
+
+		It("writes gauge and counter values", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?format=json", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+
+			Expect(writer.Write(buildCounterEnvelope("1"))).To(Succeed())
+			env := buildGaugeEnvelope("1")
+			env.GetGauge().Metrics = map[string]*loggregator_v2.GaugeValue{
+				"cpu": {Unit: "percentage", Value: 0.23},
+			}
+			Expect(writer.Write(env)).To(Succeed())
+
+			Expect(drain.bodies()).To(HaveLen(2))
+			Expect(drain.bodies()[0]).To(MatchJSON(`{
+				"timestamp": "1970-01-01T00:00:00.012345678Z",
+				"app_id": "test-app-id",
+				"hostname": "test-hostname",
+				"process_id": "[1]",
+				"instance": "1",
+				"counter": {"name": "some-counter", "total": 99, "delta": 1}
+			}`))
+			Expect(drain.bodies()[1]).To(MatchJSON(`{
+				"timestamp": "1970-01-01T00:00:00.012345678Z",
+				"app_id": "test-app-id",
+				"hostname": "test-hostname",
+				"process_id": "[1]",
+				"instance": "1",
+				"gauge": {"name": "cpu", "value": 0.23, "unit": "percentage"}
+			}`))
+		})
+
+		It("sends batches as a JSON array", func() {
+			drain := newMockBatchDrain(http.StatusOK, 1)
+			b := buildURLBinding(drain.URL+"?format=json&batch-size=300", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+			defer writer.Close()
+
+			env1 := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			env2 := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env1)).To(Succeed())
+			Expect(writer.Write(env2)).To(HaveOccurred())
+			Expect(writer.Write(env2)).To(Succeed())
+
+			Expect(drain.bodies()).To(HaveLen(2))
+			Expect(drain.bodies()[1]).To(Equal(drain.bodies()[0]))
+
+			var records []map[string]interface{}
+			Expect(json.Unmarshal(drain.bodies()[1], &records)).To(Succeed())
+			Expect(records).To(HaveLen(2))
+			Expect(records[0]["process_id"]).To(Equal("[APP/1]"))
+			Expect(records[1]["process_id"]).To(Equal("[APP/2]"))
+		})
+
+		It("sends newline delimited JSON with format=ndjson", func() {
+			drain := newMockBatchDrain(http.StatusOK, 0)
+			b := buildURLBinding(drain.URL+"?format=ndjson&batch-size=10000", "test-app-id", "test-hostname")
+			writer := egress.NewHTTPSWriter(b, netConf, true, &testhelper.SpyMetric{})
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(drain.contentTypes()).To(Equal([]string{"application/x-ndjson"}))
+			lines := bytes.Split(bytes.TrimSuffix(drain.bodies()[0], []byte("\n")), []byte("\n"))
+			Expect(lines).To(HaveLen(2))
+			for _, line := range lines {
+				Expect(line).To(MatchJSON(lines[0]))
+			}
+		})
+	})
 })
 
 type SpyDrain struct {
@@ -287,6 +699,54 @@ func newMockDrain(status int) *SpyDrain {
 	return drain
 }
 
+// spyHTTPRequest is a request recorded by a spyHTTPServer.
+type spyHTTPRequest struct {
+	path   string
+	query  string
+	header http.Header
+	body   []byte
+}
+
+// spyHTTPServer is a TLS server that records the requests it receives. The
+// respond function answers each request with the mutex held, so it may read
+// the fields of the spy that embeds the server.
+type spyHTTPServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	_requests []spyHTTPRequest
+}
+
+func newSpyHTTPServer(respond func(w http.ResponseWriter, r spyHTTPRequest)) *spyHTTPServer {
+	s := &spyHTTPServer{}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		Expect(err).ToNot(HaveOccurred())
+
+		req := spyHTTPRequest{
+			path:   r.URL.Path,
+			query:  r.URL.RawQuery,
+			header: r.Header,
+			body:   body,
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s._requests = append(s._requests, req)
+
+		respond(w, req)
+	}))
+
+	return s
+}
+
+func (s *spyHTTPServer) requests() []spyHTTPRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s._requests
+}
+
 func buildURLBinding(u, appID, hostname string) *egress.URLBinding {
 	parsedURL, _ := url.Parse(u)
 
@@ -296,3 +756,82 @@ func buildURLBinding(u, appID, hostname string) *egress.URLBinding {
 		Hostname: hostname,
 	}
 }
+
+type SpyBatchDrain struct {
+	*httptest.Server
+	mu         sync.Mutex
+	_bodies    [][]byte
+	_encodings []string
+	_types     []string
+	failures   int
+}
+
+// newMockBatchDrain returns a drain that records raw request bodies. The
+// first failures requests are answered with a 500.
+func newMockBatchDrain(status, failures int) *SpyBatchDrain {
+	drain := &SpyBatchDrain{failures: failures}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+
+		drain.mu.Lock()
+		defer drain.mu.Unlock()
+		drain._bodies = append(drain._bodies, body)
+		drain._encodings = append(drain._encodings, r.Header.Get("Content-Encoding"))
+		drain._types = append(drain._types, r.Header.Get("Content-Type"))
+
+		if drain.failures > 0 {
+			drain.failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(status)
+	})
+	drain.Server = httptest.NewTLSServer(handler)
+
+	return drain
+}
+
+func (d *SpyBatchDrain) bodies() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d._bodies
+}
+
+func (d *SpyBatchDrain) encodings() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d._encodings
+}
+
+func (d *SpyBatchDrain) contentTypes() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d._types
+}
+
+func decompress(encoding string, body []byte) string {
+	var (
+		r   io.Reader
+		err error
+	)
+
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		r = bytes.NewReader(body)
+	}
+	Expect(err).ToNot(HaveOccurred())
+
+	b, err := ioutil.ReadAll(r)
+	Expect(err).ToNot(HaveOccurred())
+
+	return string(b)
+}
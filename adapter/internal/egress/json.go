@@ -0,0 +1,144 @@
+package egress
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// jsonRecord is the JSON representation of a syslog message. See the README
+// for the documented schema.
+type jsonRecord struct {
+	Timestamp string            `json:"timestamp"`
+	AppID     string            `json:"app_id"`
+	Hostname  string            `json:"hostname"`
+	ProcessID string            `json:"process_id"`
+	Instance  string            `json:"instance,omitempty"`
+	LogType   string            `json:"log_type,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Gauge     *jsonGauge        `json:"gauge,omitempty"`
+	Counter   *jsonCounter      `json:"counter,omitempty"`
+	Timer     *jsonTimer        `json:"timer,omitempty"`
+	Event     *jsonEvent        `json:"event,omitempty"`
+}
+
+type jsonGauge struct {
+	Name  string   `json:"name"`
+	Value *float64 `json:"value"`
+	Unit  string   `json:"unit"`
+}
+
+type jsonCounter struct {
+	Name  string `json:"name"`
+	Total uint64 `json:"total"`
+	Delta uint64 `json:"delta"`
+}
+
+type jsonTimer struct {
+	Name     string `json:"name"`
+	Start    int64  `json:"start"`
+	Stop     int64  `json:"stop"`
+	Duration int64  `json:"duration"`
+}
+
+type jsonEvent struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// generateJSONRecords converts an envelope into JSON records. The records
+// hold the same messages as generateRFC5424Messages. All tags are included
+// unless the drain restricts them with include-tags.
+func generateJSONRecords(
+	env *loggregator_v2.Envelope,
+	hostname string,
+	appID string,
+	tags *tagFilter,
+) []jsonRecord {
+	if tags == nil {
+		tags = &tagFilter{all: true}
+	}
+	selected := tags.selected(env.Tags)
+
+	msgs := envelopeMessages(env)
+	records := make([]jsonRecord, 0, len(msgs))
+	for _, m := range msgs {
+		r := jsonRecord{
+			Timestamp: m.timestamp.Format(time.RFC3339Nano),
+			AppID:     appID,
+			Hostname:  hostname,
+			ProcessID: m.processID,
+			Instance:  env.InstanceId,
+			Message:   strings.TrimSuffix(string(m.payload), "\n"),
+			Tags:      selected,
+		}
+		if l := env.GetLog(); l != nil {
+			r.LogType = l.Type.String()
+		}
+
+		switch {
+		case m.gauge != nil:
+			r.Gauge = &jsonGauge{
+				Name:  m.gauge.name,
+				Value: jsonFloat(m.gauge.value),
+				Unit:  m.gauge.unit,
+			}
+		case m.counter != nil:
+			r.Counter = &jsonCounter{
+				Name:  m.counter.GetName(),
+				Total: m.counter.GetTotal(),
+				Delta: m.counter.GetDelta(),
+			}
+		case m.timer != nil:
+			r.Timer = &jsonTimer{
+				Name:     m.timer.GetName(),
+				Start:    m.timer.GetStart(),
+				Stop:     m.timer.GetStop(),
+				Duration: m.timer.GetStop() - m.timer.GetStart(),
+			}
+		case m.event != nil:
+			r.Event = &jsonEvent{
+				Title: validUTF8(m.event.GetTitle()),
+				Body:  validUTF8(m.event.GetBody()),
+			}
+		}
+
+		records = append(records, r)
+	}
+
+	return records
+}
+
+// generateJSONMessages marshals the JSON records of an envelope.
+func generateJSONMessages(
+	env *loggregator_v2.Envelope,
+	hostname string,
+	appID string,
+	tags *tagFilter,
+) ([][]byte, error) {
+	records := generateJSONRecords(env, hostname, appID, tags)
+
+	msgs := make([][]byte, 0, len(records))
+	for _, r := range records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, b)
+	}
+
+	return msgs, nil
+}
+
+// jsonFloat returns nil for values JSON cannot represent, such as NaN.
+func jsonFloat(f float64) *float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+
+	return &f
+}
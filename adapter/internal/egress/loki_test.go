@@ -0,0 +1,223 @@
+package egress_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
+	"code.cloudfoundry.org/scalable-syslog/internal/testhelper"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LokiWriter", func() {
+	var (
+		loki    *spyLoki
+		metric  *testhelper.SpyMetric
+		netConf = egress.NetworkTimeoutConfig{}
+	)
+
+	BeforeEach(func() {
+		loki = newSpyLoki()
+		metric = &testhelper.SpyMetric{}
+	})
+
+	AfterEach(func() {
+		loki.Close()
+	})
+
+	newWriter := func(query string) egress.WriteCloser {
+		u := strings.Replace(loki.URL, "https://", "loki://user:pass@", 1) + "?" + query
+		b := buildURLBinding(u, "test-app-id", "test-hostname")
+
+		return egress.LokiWriterConstructor(nil)(b, netConf, true, metric)
+	}
+
+	It("pushes streams sorted by timestamp", func() {
+		writer := newWriter("include-tags=deployment&tenant=cf")
+
+		second := buildLogEnvelope("APP", "1", "second", loggregator_v2.Log_OUT)
+		second.Tags["deployment"] = "cf"
+		second.Timestamp = 2000
+		first := buildLogEnvelope("APP", "1", "first", loggregator_v2.Log_OUT)
+		first.Tags["deployment"] = "cf"
+		first.Timestamp = 1000
+		other := buildLogEnvelope("APP", "1", "other", loggregator_v2.Log_OUT)
+		other.Timestamp = 1500
+
+		Expect(writer.Write(second)).To(Succeed())
+		Expect(writer.Write(first)).To(Succeed())
+		Expect(writer.Write(other)).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		reqs := loki.requests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].path).To(Equal("/loki/api/v1/push"))
+		Expect(reqs[0].header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(reqs[0].header.Get("X-Scope-OrgID")).To(Equal("cf"))
+		user, pass, ok := (&http.Request{Header: reqs[0].header}).BasicAuth()
+		Expect(ok).To(BeTrue())
+		Expect(user).To(Equal("user"))
+		Expect(pass).To(Equal("pass"))
+
+		Expect(reqs[0].body).To(MatchJSON(`{"streams": [
+			{
+				"stream": {"app_id": "test-app-id", "hostname": "test-hostname", "deployment": "cf"},
+				"values": [["1000", "first"], ["2000", "second"]]
+			},
+			{
+				"stream": {"app_id": "test-app-id", "hostname": "test-hostname"},
+				"values": [["1500", "other"]]
+			}
+		]}`))
+		Expect(metric.Delta()).To(Equal(uint64(3)))
+	})
+
+	It("sends other envelopes as JSON records", func() {
+		writer := newWriter("")
+
+		env := buildCounterEnvelope("1")
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		Expect(loki.requests()[0].body).To(ContainSubstring(`\"counter\":{\"name\":\"some-counter\"`))
+	})
+
+	It("does not let tags replace the stream labels", func() {
+		writer := newWriter("include-tags=true")
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		env.Tags["app_id"] = "other-app-id"
+		env.Tags["a.b"] = "first"
+		env.Tags["a-b"] = "second"
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		Expect(loki.requests()[0].body).To(MatchJSON(`{"streams": [{
+			"stream": {"app_id": "test-app-id", "hostname": "test-hostname", "a_b": "second", "source_type": "APP"},
+			"values": [["12345678", "just a test"]]
+		}]}`))
+	})
+
+	DescribeTable("rejects tags that map to a reserved or shared label", func(query, errMsg string) {
+		writer := newWriter(query)
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(MatchError(ContainSubstring(errMsg)))
+		Expect(writer.Close()).To(Succeed())
+		Expect(loki.requests()).To(BeEmpty())
+	},
+		Entry("reserved label", "include-tags=deployment,hostname", `tag "hostname" would replace the hostname label`),
+		Entry("shared label", "include-tags=a.b,a-b", `tags "a-b" and "a.b" both map to the a_b label`),
+	)
+
+	Describe("out of order entries", func() {
+		var (
+			droppedMetric *testhelper.SpyMetric
+			cancel        context.CancelFunc
+		)
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		connect := func() {
+			droppedMetric = &testhelper.SpyMetric{}
+			connector := egress.NewSyslogConnector(
+				netConf,
+				true,
+				&SpyWaitGroup{},
+				egress.WithConstructors(map[string]egress.WriterConstructor{
+					"loki": egress.LokiWriterConstructor(nil),
+				}),
+				egress.WithEgressMetrics(map[string]pulseemitter.CounterMetric{
+					"loki": metric,
+				}),
+				egress.WithDroppedMetrics(map[string]pulseemitter.CounterMetric{
+					"loki": droppedMetric,
+				}),
+				egress.WithLogClient(newSpyLogClient(), "3"),
+			)
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			writer, err := connector.Connect(ctx, &v1.Binding{
+				AppId: "app-id",
+				Drain: strings.Replace(loki.URL, "https://", "loki://", 1) + "?batch-size=100000&batch-delay=10ms",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			for i := 0; i < 3; i++ {
+				env := buildLogEnvelope("APP", "1", fmt.Sprintf("log %d", i), loggregator_v2.Log_OUT)
+				Expect(writer.Write(env)).To(Succeed())
+			}
+		}
+
+		It("reports the entries Loki ignored as dropped", func() {
+			loki.status = http.StatusBadRequest
+			loki.response = "entry with timestamp 1970-01-01 00:00:00.012345678 +0000 UTC ignored, " +
+				"reason: 'entry out of order' for stream: {app_id=\"app-id\"},\ntotal ignored: 2 out of 3"
+			connect()
+
+			Eventually(droppedMetric.Delta).Should(Equal(uint64(2)))
+			Expect(loki.requests()).To(HaveLen(1))
+			Expect(metric.Delta()).To(Equal(uint64(1)))
+		})
+
+		It("does not report the batch as dropped if Loki does not say how many entries it ignored", func() {
+			loki.status = http.StatusBadRequest
+			loki.response = "entry out of order for stream"
+			connect()
+
+			Eventually(loki.requests).Should(HaveLen(1))
+			Consistently(loki.requests).Should(HaveLen(1))
+			Expect(droppedMetric.Delta()).To(BeZero())
+		})
+	})
+
+	It("keeps the batch when Loki is unavailable", func() {
+		loki.status = http.StatusServiceUnavailable
+		writer := newWriter("batch-size=1")
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(MatchError(ContainSubstring("503")))
+
+		loki.setStatus(http.StatusNoContent)
+		Expect(writer.Write(env)).To(Succeed())
+
+		reqs := loki.requests()
+		Expect(reqs).To(HaveLen(2))
+		Expect(reqs[1].body).To(Equal(reqs[0].body))
+		Expect(metric.Delta()).To(Equal(uint64(1)))
+	})
+})
+
+type spyLoki struct {
+	*spyHTTPServer
+
+	status   int
+	response string
+}
+
+func newSpyLoki() *spyLoki {
+	l := &spyLoki{status: http.StatusNoContent}
+	l.spyHTTPServer = newSpyHTTPServer(func(w http.ResponseWriter, r spyHTTPRequest) {
+		w.WriteHeader(l.status)
+		w.Write([]byte(l.response))
+	})
+
+	return l
+}
+
+func (l *spyLoki) setStatus(status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.status = status
+}
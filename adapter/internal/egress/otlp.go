@@ -0,0 +1,575 @@
+package egress
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/golang/protobuf/proto"
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+	logs "go.opentelemetry.io/proto/otlp/logs/v1"
+	metrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resource "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	otlpLogsPath    = "/v1/logs"
+	otlpMetricsPath = "/v1/metrics"
+)
+
+// OTLPWriter exports envelopes to an OpenTelemetry collector. Logs are
+// exported as log records, gauges and counters as metrics. All other
+// envelopes are ignored. Records are batched like the messages of an
+// HTTPSWriter and each batch is exported with one logs and one metrics
+// request.
+type OTLPWriter struct {
+	binding      *URLBinding
+	url          *url.URL
+	appID        string
+	hostname     string
+	tags         *tagFilter
+	timeout      time.Duration
+	egressMetric pulseemitter.CounterMetric
+	exporter     otlpExporter
+	tlsErr       error
+
+	starts *counterStarts
+
+	batcher     *batcher
+	logs        []*logs.ResourceLogs
+	metrics     []*metrics.ResourceMetrics
+	logCount    int
+	logBytes    int
+	metricCount int
+	metricBytes int
+}
+
+// otlpExporter sends export requests over one of the OTLP transports.
+type otlpExporter interface {
+	// exportLogs and exportMetrics return the number of items the collector
+	// accepted the request for but rejected.
+	exportLogs(ctx context.Context, req *collogs.ExportLogsServiceRequest) (int64, error)
+	exportMetrics(ctx context.Context, req *colmetrics.ExportMetricsServiceRequest) (int64, error)
+	close() error
+}
+
+// OTLPWriterConstructor returns a WriterConstructor for otlp-grpc and
+// otlp-http drains. Both connect to the drain host with TLS, for example:
+//
+//	otlp-grpc://otel.example.com:4317
+//	otlp-http://otel.example.com:4318
+//
+// otlp-http drains post protobuf encoded requests to /v1/logs and
+// /v1/metrics below the path of the drain URL. The batch-size and
+// batch-delay query parameters work as they do for HTTPS drains. A nil TLS
+// config uses api.NewTLSConfig.
+func OTLPWriterConstructor(tlsConfig *tls.Config) WriterConstructor {
+	return WriterConstructor(func(
+		binding *URLBinding,
+		netConf NetworkTimeoutConfig,
+		skipCertVerify bool,
+		egressMetric pulseemitter.CounterMetric,
+	) WriteCloser {
+		w := &OTLPWriter{
+			binding:      binding,
+			url:          binding.URL,
+			appID:        binding.AppID,
+			hostname:     binding.Hostname,
+			tags:         tagsFromURL(binding.URL),
+			timeout:      netConf.WriteTimeout,
+			egressMetric: egressMetric,
+			starts:       otlpCounterStarts,
+		}
+
+		size, delay := httpsBatchSettings(binding.URL, defaultHTTPSBatchSize, defaultHTTPSBatchDelay)
+		w.batcher = newBatcher(w, binding, size, delay)
+
+		conf, err := drainTLSConfig(tlsConfig, binding, skipCertVerify)
+		if err != nil {
+			w.tlsErr = err
+			return w
+		}
+
+		if binding.URL.Scheme == "otlp-grpc" {
+			w.exporter = newOTLPGRPCExporter(binding.URL, netConf, conf, binding.proxy)
+			return w
+		}
+		w.exporter = newOTLPHTTPExporter(binding.URL, netConf, conf, binding.proxy)
+
+		return w
+	})
+}
+
+// Write adds the envelope to the current batch and exports the batch when
+// it is full. It returns an error if the collector does not accept the
+// export request, in which case the batch is kept for the RetryWriter.
+func (w *OTLPWriter) Write(env *loggregator_v2.Envelope) error {
+	return w.batcher.write(env)
+}
+
+// Close exports any pending records and closes the connection to the
+// collector.
+func (w *OTLPWriter) Close() error {
+	err := w.batcher.close()
+	if w.exporter == nil {
+		return err
+	}
+
+	if cerr := w.exporter.close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func (w *OTLPWriter) add(env *loggregator_v2.Envelope) error {
+	switch env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		rl := w.resourceLogs(env)
+		w.logCount++
+		w.logBytes += proto.Size(rl)
+
+		// Consecutive records of the same resource share one entry.
+		if n := len(w.logs); n > 0 && proto.Equal(w.logs[n-1].Resource, rl.Resource) {
+			sl := w.logs[n-1].ScopeLogs[0]
+			sl.LogRecords = append(sl.LogRecords, rl.ScopeLogs[0].LogRecords...)
+			return nil
+		}
+		w.logs = append(w.logs, rl)
+	case *loggregator_v2.Envelope_Gauge, *loggregator_v2.Envelope_Counter:
+		rm := w.resourceMetrics(env)
+		w.metricCount++
+		w.metricBytes += proto.Size(rm)
+
+		if n := len(w.metrics); n > 0 && proto.Equal(w.metrics[n-1].Resource, rm.Resource) {
+			sm := w.metrics[n-1].ScopeMetrics[0]
+			sm.Metrics = append(sm.Metrics, rm.ScopeMetrics[0].Metrics...)
+			return nil
+		}
+		w.metrics = append(w.metrics, rm)
+	}
+
+	return nil
+}
+
+func (w *OTLPWriter) pending() (int, int) {
+	return w.logCount + w.metricCount, w.logBytes + w.metricBytes
+}
+
+func (w *OTLPWriter) reset() {
+	w.resetLogs()
+	w.resetMetrics()
+}
+
+func (w *OTLPWriter) resetLogs() {
+	w.logs = nil
+	w.logCount = 0
+	w.logBytes = 0
+}
+
+func (w *OTLPWriter) resetMetrics() {
+	w.metrics = nil
+	w.metricCount = 0
+	w.metricBytes = 0
+}
+
+// send exports the pending logs and metrics. Whatever the collector
+// accepted is removed from the batch so that a retry only sends the rest.
+func (w *OTLPWriter) send(ctx context.Context) error {
+	if w.tlsErr != nil {
+		return w.tlsErr
+	}
+
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+
+	if len(w.logs) > 0 {
+		rejected, err := w.exporter.exportLogs(ctx, &collogs.ExportLogsServiceRequest{ResourceLogs: w.logs})
+		if err != nil {
+			return err
+		}
+		w.egressMetric.Increment(uint64(w.logCount))
+		w.binding.reportDropped(int(rejected))
+		w.resetLogs()
+	}
+
+	if len(w.metrics) > 0 {
+		rejected, err := w.exporter.exportMetrics(ctx, &colmetrics.ExportMetricsServiceRequest{ResourceMetrics: w.metrics})
+		if err != nil {
+			return err
+		}
+		w.egressMetric.Increment(uint64(w.metricCount))
+		w.binding.reportDropped(int(rejected))
+		w.resetMetrics()
+	}
+
+	return nil
+}
+
+// resource describes the app the envelope belongs to. All tags are added
+// as attributes unless the drain restricts them with include-tags.
+func (w *OTLPWriter) resource(env *loggregator_v2.Envelope) *resource.Resource {
+	tags := w.tags
+	if tags == nil {
+		tags = &tagFilter{all: true}
+	}
+	selected := tags.selected(env.Tags)
+
+	names := make([]string, 0, len(selected))
+	for n := range selected {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	attrs := []*common.KeyValue{
+		stringAttribute("app_id", w.appID),
+		stringAttribute("hostname", w.hostname),
+	}
+	for _, n := range names {
+		attrs = append(attrs, stringAttribute(n, selected[n]))
+	}
+
+	return &resource.Resource{Attributes: attrs}
+}
+
+func (w *OTLPWriter) resourceLogs(env *loggregator_v2.Envelope) *logs.ResourceLogs {
+	l := env.GetLog()
+
+	severity, severityText := logs.SeverityNumber_SEVERITY_NUMBER_INFO, "OUT"
+	if l.GetType() == loggregator_v2.Log_ERR {
+		severity, severityText = logs.SeverityNumber_SEVERITY_NUMBER_ERROR, "ERR"
+	}
+
+	record := &logs.LogRecord{
+		TimeUnixNano:         uint64(env.GetTimestamp()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severity,
+		SeverityText:         severityText,
+		Body: &common.AnyValue{
+			Value: &common.AnyValue_StringValue{StringValue: string(l.GetPayload())},
+		},
+		Attributes: []*common.KeyValue{
+			stringAttribute("instance_id", env.GetInstanceId()),
+		},
+	}
+
+	return &logs.ResourceLogs{
+		Resource: w.resource(env),
+		ScopeLogs: []*logs.ScopeLogs{{
+			LogRecords: []*logs.LogRecord{record},
+		}},
+	}
+}
+
+// resourceMetrics converts every value of a gauge into a gauge metric and a
+// counter into a cumulative, monotonic sum. Sums start when the adapter first
+// saw the counter since the total of a counter is not known to start
+// anywhere else.
+func (w *OTLPWriter) resourceMetrics(env *loggregator_v2.Envelope) *metrics.ResourceMetrics {
+	ts := uint64(env.GetTimestamp())
+	attrs := []*common.KeyValue{
+		stringAttribute("instance_id", env.GetInstanceId()),
+	}
+
+	var ms []*metrics.Metric
+	switch m := env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Gauge:
+		names := make([]string, 0, len(m.Gauge.GetMetrics()))
+		for n := range m.Gauge.GetMetrics() {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		for _, n := range names {
+			v := m.Gauge.GetMetrics()[n]
+			ms = append(ms, &metrics.Metric{
+				Name: n,
+				Unit: v.GetUnit(),
+				Data: &metrics.Metric_Gauge{Gauge: &metrics.Gauge{
+					DataPoints: []*metrics.NumberDataPoint{{
+						TimeUnixNano: ts,
+						Attributes:   attrs,
+						Value:        &metrics.NumberDataPoint_AsDouble{AsDouble: v.GetValue()},
+					}},
+				}},
+			})
+		}
+	case *loggregator_v2.Envelope_Counter:
+		ms = append(ms, &metrics.Metric{
+			Name: m.Counter.GetName(),
+			Data: &metrics.Metric_Sum{Sum: &metrics.Sum{
+				AggregationTemporality: metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+				DataPoints: []*metrics.NumberDataPoint{{
+					StartTimeUnixNano: w.starts.start(counterKey(env), m.Counter.GetTotal(), time.Now()),
+					TimeUnixNano:      ts,
+					Attributes:        attrs,
+					Value:             &metrics.NumberDataPoint_AsInt{AsInt: int64(m.Counter.GetTotal())},
+				}},
+			}},
+		})
+	}
+
+	return &metrics.ResourceMetrics{
+		Resource: w.resource(env),
+		ScopeMetrics: []*metrics.ScopeMetrics{{
+			Metrics: ms,
+		}},
+	}
+}
+
+// otlpCounterStartRetention is how long the start time of a counter series
+// is kept after the series was last exported.
+const otlpCounterStartRetention = time.Hour
+
+// otlpCounterStarts is shared by all OTLP writers so that the start time of
+// a counter series survives reconnects and rebuilds of the writers.
+var otlpCounterStarts = newCounterStarts()
+
+// counterStarts remembers the start time of the cumulative sum of each
+// counter series. A series starts when it is first seen and starts again
+// when its total goes down, since that means the counter was reset.
+type counterStarts struct {
+	mu        sync.Mutex
+	series    map[string]*counterSeries
+	lastSweep time.Time
+}
+
+type counterSeries struct {
+	start uint64
+	total uint64
+	seen  time.Time
+}
+
+func newCounterStarts() *counterStarts {
+	return &counterStarts{
+		series: make(map[string]*counterSeries),
+	}
+}
+
+// start returns the start time of the series with the given total. Series
+// not seen for otlpCounterStartRetention are forgotten.
+func (c *counterStarts) start(key string, total uint64, now time.Time) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) > otlpCounterStartRetention {
+		for k, s := range c.series {
+			if now.Sub(s.seen) > otlpCounterStartRetention {
+				delete(c.series, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	s, ok := c.series[key]
+	if !ok || total < s.total {
+		s = &counterSeries{start: uint64(now.UnixNano())}
+		c.series[key] = s
+	}
+	s.total = total
+	s.seen = now
+
+	return s.start
+}
+
+// counterKey identifies the series of a counter envelope.
+func counterKey(env *loggregator_v2.Envelope) string {
+	tags := make([]string, 0, len(env.GetTags()))
+	for k, v := range env.GetTags() {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+
+	return strings.Join(append([]string{
+		env.GetSourceId(),
+		env.GetInstanceId(),
+		env.GetCounter().GetName(),
+	}, tags...), "\x00")
+}
+
+func stringAttribute(k, v string) *common.KeyValue {
+	return &common.KeyValue{
+		Key:   k,
+		Value: &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v}},
+	}
+}
+
+// otlpGRPCExporter exports over a gRPC connection. The connection is
+// established in the background and reestablished by gRPC when it breaks.
+type otlpGRPCExporter struct {
+	conn    *grpc.ClientConn
+	err     error
+	logs    collogs.LogsServiceClient
+	metrics colmetrics.MetricsServiceClient
+}
+
+func newOTLPGRPCExporter(u *url.URL, netConf NetworkTimeoutConfig, conf *tls.Config, p *Proxy) *otlpGRPCExporter {
+	dialer := &net.Dialer{
+		Timeout:   netConf.DialTimeout,
+		KeepAlive: netConf.Keepalive,
+	}
+	dial := p.dialContext(dialer, true)
+	conn, err := grpc.Dial(u.Host,
+		grpc.WithTransportCredentials(credentials.NewTLS(conf)),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dial(ctx, "tcp", addr)
+		}),
+	)
+	if err != nil {
+		return &otlpGRPCExporter{err: err}
+	}
+
+	return &otlpGRPCExporter{
+		conn:    conn,
+		logs:    collogs.NewLogsServiceClient(conn),
+		metrics: colmetrics.NewMetricsServiceClient(conn),
+	}
+}
+
+func (e *otlpGRPCExporter) exportLogs(ctx context.Context, req *collogs.ExportLogsServiceRequest) (int64, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	resp, err := e.logs.Export(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+
+	return logPartialSuccess(resp.GetPartialSuccess().GetRejectedLogRecords(), resp.GetPartialSuccess().GetErrorMessage()), nil
+}
+
+func (e *otlpGRPCExporter) exportMetrics(ctx context.Context, req *colmetrics.ExportMetricsServiceRequest) (int64, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	resp, err := e.metrics.Export(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+
+	return logPartialSuccess(resp.GetPartialSuccess().GetRejectedDataPoints(), resp.GetPartialSuccess().GetErrorMessage()), nil
+}
+
+func (e *otlpGRPCExporter) close() error {
+	if e.conn == nil {
+		return nil
+	}
+
+	return e.conn.Close()
+}
+
+// otlpHTTPExporter exports protobuf encoded requests over HTTPS.
+type otlpHTTPExporter struct {
+	logsURL    string
+	metricsURL string
+	client     *http.Client
+}
+
+func newOTLPHTTPExporter(u *url.URL, netConf NetworkTimeoutConfig, conf *tls.Config, p *Proxy) *otlpHTTPExporter {
+	endpoint := url.URL{
+		Scheme: "https",
+		Host:   u.Host,
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+
+	endpoint.Path = path + otlpLogsPath
+	logsURL := endpoint.String()
+	endpoint.Path = path + otlpMetricsPath
+	metricsURL := endpoint.String()
+
+	return &otlpHTTPExporter{
+		logsURL:    logsURL,
+		metricsURL: metricsURL,
+		client:     httpClient(netConf, conf, p),
+	}
+}
+
+func (e *otlpHTTPExporter) exportLogs(ctx context.Context, req *collogs.ExportLogsServiceRequest) (int64, error) {
+	var resp collogs.ExportLogsServiceResponse
+	if err := e.post(ctx, e.logsURL, req, &resp); err != nil {
+		return 0, err
+	}
+
+	return logPartialSuccess(resp.GetPartialSuccess().GetRejectedLogRecords(), resp.GetPartialSuccess().GetErrorMessage()), nil
+}
+
+func (e *otlpHTTPExporter) exportMetrics(ctx context.Context, req *colmetrics.ExportMetricsServiceRequest) (int64, error) {
+	var resp colmetrics.ExportMetricsServiceResponse
+	if err := e.post(ctx, e.metricsURL, req, &resp); err != nil {
+		return 0, err
+	}
+
+	return logPartialSuccess(resp.GetPartialSuccess().GetRejectedDataPoints(), resp.GetPartialSuccess().GetErrorMessage()), nil
+}
+
+func (e *otlpHTTPExporter) post(ctx context.Context, u string, req, resp proto.Message) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+
+	httpResp, err := e.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return fmt.Errorf("OTLP Writer: Post responded with %d status code", httpResp.StatusCode)
+	}
+
+	var respBody bytes.Buffer
+	if _, err := respBody.ReadFrom(httpResp.Body); err != nil {
+		return err
+	}
+	if respBody.Len() == 0 {
+		return nil
+	}
+
+	return proto.Unmarshal(respBody.Bytes(), resp)
+}
+
+func (e *otlpHTTPExporter) close() error {
+	return nil
+}
+
+// logPartialSuccess logs data the collector accepted the request for but
+// rejected and returns the number of rejected items. Rejected data is not
+// retried.
+func logPartialSuccess(rejected int64, msg string) int64 {
+	if rejected == 0 && msg == "" {
+		return 0
+	}
+
+	log.Printf("otlp collector rejected %d items: %s", rejected, msg)
+
+	return rejected
+}
@@ -0,0 +1,356 @@
+package egress_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/test_util"
+	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
+	"code.cloudfoundry.org/scalable-syslog/internal/testhelper"
+	"github.com/golang/protobuf/proto"
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+	logs "go.opentelemetry.io/proto/otlp/logs/v1"
+	metrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OTLPWriter", func() {
+	var (
+		metric  *testhelper.SpyMetric
+		netConf = egress.NetworkTimeoutConfig{WriteTimeout: 5 * time.Second}
+	)
+
+	BeforeEach(func() {
+		metric = &testhelper.SpyMetric{}
+	})
+
+	attributes := func(kvs []*common.KeyValue) map[string]string {
+		m := make(map[string]string)
+		for _, kv := range kvs {
+			m[kv.GetKey()] = kv.GetValue().GetStringValue()
+		}
+		return m
+	}
+
+	Context("with otlp-http", func() {
+		var collector *spyOTLPHTTP
+
+		BeforeEach(func() {
+			collector = newSpyOTLPHTTP()
+		})
+
+		AfterEach(func() {
+			collector.Close()
+		})
+
+		newWriter := func(query string) egress.WriteCloser {
+			u := strings.Replace(collector.URL, "https://", "otlp-http://", 1) + "/otlp?" + query
+			b := buildURLBinding(u, "test-app-id", "test-hostname")
+
+			return egress.OTLPWriterConstructor(nil)(b, netConf, true, metric)
+		}
+
+		It("exports logs as log records", func() {
+			writer := newWriter("batch-size=1")
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_ERR)
+			Expect(writer.Write(env)).To(Succeed())
+
+			reqs := collector.requests()
+			Expect(reqs).To(HaveLen(1))
+			Expect(reqs[0].path).To(Equal("/otlp/v1/logs"))
+			Expect(reqs[0].header.Get("Content-Type")).To(Equal("application/x-protobuf"))
+
+			var req collogs.ExportLogsServiceRequest
+			Expect(proto.Unmarshal(reqs[0].body, &req)).To(Succeed())
+			Expect(req.ResourceLogs).To(HaveLen(1))
+			Expect(attributes(req.ResourceLogs[0].GetResource().GetAttributes())).To(Equal(map[string]string{
+				"app_id":      "test-app-id",
+				"hostname":    "test-hostname",
+				"source_type": "APP",
+			}))
+
+			record := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+			Expect(record.GetTimeUnixNano()).To(Equal(uint64(12345678)))
+			Expect(record.GetSeverityNumber()).To(Equal(logs.SeverityNumber_SEVERITY_NUMBER_ERROR))
+			Expect(record.GetSeverityText()).To(Equal("ERR"))
+			Expect(record.GetBody().GetStringValue()).To(Equal("just a test"))
+			Expect(attributes(record.GetAttributes())).To(Equal(map[string]string{"instance_id": "1"}))
+			Expect(metric.Delta()).To(Equal(uint64(1)))
+		})
+
+		It("exports counters as sums", func() {
+			before := uint64(time.Now().UnixNano())
+			writer := newWriter("batch-size=1")
+
+			Expect(writer.Write(buildCounterEnvelope("exported-as-sum"))).To(Succeed())
+
+			reqs := collector.requests()
+			Expect(reqs).To(HaveLen(1))
+			Expect(reqs[0].path).To(Equal("/otlp/v1/metrics"))
+
+			var req colmetrics.ExportMetricsServiceRequest
+			Expect(proto.Unmarshal(reqs[0].body, &req)).To(Succeed())
+			m := req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+			Expect(m.GetName()).To(Equal("some-counter"))
+			Expect(m.GetSum().GetIsMonotonic()).To(BeTrue())
+			Expect(m.GetSum().GetAggregationTemporality()).To(Equal(metrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE))
+			Expect(m.GetSum().GetDataPoints()[0].GetAsInt()).To(Equal(int64(99)))
+			Expect(m.GetSum().GetDataPoints()[0].GetStartTimeUnixNano()).To(BeNumerically(">=", before))
+		})
+
+		It("keeps the start time of a counter across writers", func() {
+			startTime := func() uint64 {
+				reqs := collector.requests()
+				var req colmetrics.ExportMetricsServiceRequest
+				Expect(proto.Unmarshal(reqs[len(reqs)-1].body, &req)).To(Succeed())
+				return req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetSum().GetDataPoints()[0].GetStartTimeUnixNano()
+			}
+			counter := func(total uint64) *loggregator_v2.Envelope {
+				env := buildCounterEnvelope("kept-across-writers")
+				env.GetCounter().Total = total
+				return env
+			}
+
+			Expect(newWriter("batch-size=1").Write(counter(10))).To(Succeed())
+			start := startTime()
+			Expect(newWriter("batch-size=1").Write(counter(20))).To(Succeed())
+			Expect(startTime()).To(Equal(start))
+
+			Expect(newWriter("batch-size=1").Write(counter(5))).To(Succeed())
+			Expect(startTime()).To(BeNumerically(">", start))
+		})
+
+		It("reports items rejected by the collector as dropped", func() {
+			collector.rejected = 1
+			droppedMetric := &testhelper.SpyMetric{}
+			logClient := newSpyLogClient()
+			connector := egress.NewSyslogConnector(
+				netConf,
+				true,
+				&SpyWaitGroup{},
+				egress.WithConstructors(map[string]egress.WriterConstructor{
+					"otlp-http": egress.OTLPWriterConstructor(nil),
+				}),
+				egress.WithEgressMetrics(map[string]pulseemitter.CounterMetric{
+					"otlp-http": metric,
+				}),
+				egress.WithDroppedMetrics(map[string]pulseemitter.CounterMetric{
+					"otlp-http": droppedMetric,
+				}),
+				egress.WithLogClient(logClient, "3"),
+			)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			writer, err := connector.Connect(ctx, &v1.Binding{
+				AppId: "app-id",
+				Drain: strings.Replace(collector.URL, "https://", "otlp-http://", 1) + "?batch-size=1",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+
+			Eventually(droppedMetric.Delta).Should(Equal(uint64(1)))
+			Expect(logClient.message()).To(ContainElement("1 messages lost in user provided syslog drain"))
+		})
+
+		It("exports a batch of records in one request", func() {
+			writer := newWriter("")
+
+			for i := 0; i < 3; i++ {
+				env := buildLogEnvelope("APP", "1", fmt.Sprintf("log %d", i), loggregator_v2.Log_OUT)
+				Expect(writer.Write(env)).To(Succeed())
+			}
+			Expect(collector.requests()).To(BeEmpty())
+			Expect(writer.Close()).To(Succeed())
+
+			reqs := collector.requests()
+			Expect(reqs).To(HaveLen(1))
+
+			var req collogs.ExportLogsServiceRequest
+			Expect(proto.Unmarshal(reqs[0].body, &req)).To(Succeed())
+			Expect(req.ResourceLogs).To(HaveLen(1))
+			records := req.ResourceLogs[0].ScopeLogs[0].LogRecords
+			Expect(records).To(HaveLen(3))
+			Expect(records[2].GetBody().GetStringValue()).To(Equal("log 2"))
+			Expect(metric.Delta()).To(Equal(uint64(3)))
+		})
+
+		It("ignores timers", func() {
+			writer := newWriter("batch-size=1")
+
+			Expect(writer.Write(buildTimerEnvelope())).To(Succeed())
+			Expect(writer.Close()).To(Succeed())
+			Expect(collector.requests()).To(BeEmpty())
+			Expect(metric.Delta()).To(Equal(uint64(0)))
+		})
+
+		It("returns an error when the collector fails", func() {
+			collector.status = http.StatusServiceUnavailable
+			writer := newWriter("batch-size=1")
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(MatchError(ContainSubstring("503")))
+		})
+	})
+
+	Context("with otlp-grpc", func() {
+		var collector *spyOTLPGRPC
+
+		BeforeEach(func() {
+			collector = newSpyOTLPGRPC()
+		})
+
+		AfterEach(func() {
+			collector.stop()
+		})
+
+		newWriter := func() egress.WriteCloser {
+			u := fmt.Sprintf("otlp-grpc://%s", collector.addr)
+			b := buildURLBinding(u, "test-app-id", "test-hostname")
+
+			return egress.OTLPWriterConstructor(nil)(b, netConf, true, metric)
+		}
+
+		It("exports logs and gauges", func() {
+			writer := newWriter()
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+			Expect(writer.Write(buildGaugeEnvelope("1"))).To(Succeed())
+			Expect(writer.Close()).To(Succeed())
+
+			logReqs, metricReqs := collector.requests()
+			Expect(logReqs).To(HaveLen(1))
+			record := logReqs[0].ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+			Expect(record.GetSeverityNumber()).To(Equal(logs.SeverityNumber_SEVERITY_NUMBER_INFO))
+			Expect(record.GetBody().GetStringValue()).To(Equal("just a test"))
+
+			Expect(metricReqs).To(HaveLen(1))
+			ms := metricReqs[0].ResourceMetrics[0].ScopeMetrics[0].Metrics
+			Expect(ms).To(HaveLen(5))
+			Expect(ms[0].GetName()).To(Equal("cpu"))
+			Expect(ms[0].GetUnit()).To(Equal("percentage"))
+			Expect(ms[0].GetGauge().GetDataPoints()[0].GetAsDouble()).To(Equal(0.23))
+			Expect(metric.Delta()).To(Equal(uint64(2)))
+		})
+	})
+})
+
+type spyOTLPHTTP struct {
+	*spyHTTPServer
+
+	status   int
+	rejected int64
+}
+
+func newSpyOTLPHTTP() *spyOTLPHTTP {
+	s := &spyOTLPHTTP{status: http.StatusOK}
+	s.spyHTTPServer = newSpyHTTPServer(func(w http.ResponseWriter, r spyHTTPRequest) {
+		w.WriteHeader(s.status)
+		if s.rejected == 0 || r.path != "/v1/logs" {
+			return
+		}
+
+		body, _ := proto.Marshal(&collogs.ExportLogsServiceResponse{
+			PartialSuccess: &collogs.ExportLogsPartialSuccess{
+				RejectedLogRecords: s.rejected,
+				ErrorMessage:       "some-error",
+			},
+		})
+		w.Write(body)
+	})
+
+	return s
+}
+
+type spyOTLPGRPC struct {
+	addr    string
+	server  *grpc.Server
+	logs    *spyLogsService
+	metrics *spyMetricsService
+}
+
+func newSpyOTLPGRPC() *spyOTLPGRPC {
+	cert, err := tls.LoadX509KeyPair(
+		test_util.Cert("adapter-rlp.crt"),
+		test_util.Cert("adapter-rlp.key"),
+	)
+	Expect(err).ToNot(HaveOccurred())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+
+	s := &spyOTLPGRPC{
+		addr: lis.Addr().String(),
+		server: grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}))),
+		logs:    &spyLogsService{},
+		metrics: &spyMetricsService{},
+	}
+	collogs.RegisterLogsServiceServer(s.server, s.logs)
+	colmetrics.RegisterMetricsServiceServer(s.server, s.metrics)
+	go s.server.Serve(lis)
+
+	return s
+}
+
+func (s *spyOTLPGRPC) requests() ([]*collogs.ExportLogsServiceRequest, []*colmetrics.ExportMetricsServiceRequest) {
+	s.logs.mu.Lock()
+	defer s.logs.mu.Unlock()
+	s.metrics.mu.Lock()
+	defer s.metrics.mu.Unlock()
+
+	return s.logs.reqs, s.metrics.reqs
+}
+
+func (s *spyOTLPGRPC) stop() {
+	s.server.Stop()
+}
+
+type spyLogsService struct {
+	collogs.UnimplementedLogsServiceServer
+
+	mu   sync.Mutex
+	reqs []*collogs.ExportLogsServiceRequest
+}
+
+func (s *spyLogsService) Export(ctx context.Context, req *collogs.ExportLogsServiceRequest) (*collogs.ExportLogsServiceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs = append(s.reqs, req)
+
+	return &collogs.ExportLogsServiceResponse{}, nil
+}
+
+type spyMetricsService struct {
+	colmetrics.UnimplementedMetricsServiceServer
+
+	mu   sync.Mutex
+	reqs []*colmetrics.ExportMetricsServiceRequest
+}
+
+func (s *spyMetricsService) Export(ctx context.Context, req *colmetrics.ExportMetricsServiceRequest) (*colmetrics.ExportMetricsServiceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs = append(s.reqs, req)
+
+	return &colmetrics.ExportMetricsServiceResponse{}, nil
+}
@@ -0,0 +1,318 @@
+package egress
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/scalable-syslog/internal/api"
+	"golang.org/x/net/proxy"
+)
+
+// Proxy connects to drains through an HTTP CONNECT or SOCKS5 proxy. When
+// both are configured, syslog and syslog-tls drains use the SOCKS5 proxy
+// and HTTP based drains use the HTTP proxy. Hosts on the no-proxy list are
+// connected to directly.
+type Proxy struct {
+	httpURL   *url.URL
+	socks5URL *url.URL
+
+	noProxyNets    []*net.IPNet
+	noProxyDomains []string
+}
+
+// NewProxy parses the proxy configuration. httpProxy is an http:// or
+// https:// URL and socks5Proxy a socks5:// URL, either of which may carry
+// the proxy credentials as user info. noProxy lists IPs, CIDRs and domains
+// that are not proxied. A domain also matches its subdomains. It returns
+// nil when no proxy is configured.
+func NewProxy(httpProxy, socks5Proxy string, noProxy []string) (*Proxy, error) {
+	if httpProxy == "" && socks5Proxy == "" {
+		return nil, nil
+	}
+
+	p := &Proxy{}
+
+	var err error
+	if httpProxy != "" {
+		p.httpURL, err = parseProxyURL(httpProxy, "http", "https")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if socks5Proxy != "" {
+		p.socks5URL, err = parseProxyURL(socks5Proxy, "socks5")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range noProxy {
+		s := strings.ToLower(strings.TrimSpace(entry))
+		if s == "" {
+			continue
+		}
+
+		if _, n, err := net.ParseCIDR(s); err == nil {
+			p.noProxyNets = append(p.noProxyNets, n)
+			continue
+		}
+		if ip := net.ParseIP(s); ip != nil {
+			p.noProxyNets = append(p.noProxyNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "*"), ".")
+		if s == "" || strings.ContainsAny(s, "/:*") {
+			return nil, fmt.Errorf("invalid no-proxy entry %q", entry)
+		}
+		p.noProxyDomains = append(p.noProxyDomains, s)
+	}
+
+	return p, nil
+}
+
+func parseProxyURL(s string, schemes ...string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %s", err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy URL %s: missing host", u.Redacted())
+	}
+
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return u, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid proxy URL %s: scheme must be %s", u.Redacted(), strings.Join(schemes, " or "))
+}
+
+// ProxyError is returned when a drain could not be reached because
+// connecting through the proxy failed.
+type ProxyError struct {
+	// Proxy is the host and port of the proxy.
+	Proxy string
+	Err   error
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("proxy %s: %s", e.Proxy, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// isProxyError reports whether err was caused by the proxy.
+func isProxyError(err error) bool {
+	var pe *ProxyError
+	return errors.As(err, &pe)
+}
+
+// dialContext returns a function that connects to an address over TCP,
+// through the proxy unless the host is excluded. preferHTTP picks the HTTP
+// proxy over the SOCKS5 proxy when both are configured. A nil proxy always
+// connects directly.
+func (p *Proxy) dialContext(d *net.Dialer, preferHTTP bool) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if p == nil {
+		return d.DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		u := p.proxyFor(addr, preferHTTP)
+		if u == nil {
+			return d.DialContext(ctx, network, addr)
+		}
+
+		if d.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+			defer cancel()
+		}
+
+		var (
+			conn net.Conn
+			err  error
+		)
+		if u.Scheme == "socks5" {
+			conn, err = dialSOCKS5(ctx, d, u, addr)
+		} else {
+			conn, err = dialConnect(ctx, d, u, addr)
+		}
+		if err != nil {
+			return nil, &ProxyError{Proxy: proxyHostPort(u), Err: err}
+		}
+
+		return conn, nil
+	}
+}
+
+// dialTLS connects to a syslog-tls drain through the proxy and performs the
+// TLS handshake over the tunnel.
+func (p *Proxy) dialTLS(d *net.Dialer, addr string, conf *tls.Config) (net.Conn, error) {
+	conn, err := p.dialContext(d, false)(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		conf = conf.Clone()
+		conf.ServerName = host
+	}
+
+	if d.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.Timeout))
+	}
+	tlsConn := tls.Client(conn, conf)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+// proxyFor returns the proxy used to connect to addr, or nil if addr is on
+// the no-proxy list.
+func (p *Proxy) proxyFor(addr string, preferHTTP bool) *url.URL {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	host = strings.ToLower(host)
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, n := range p.noProxyNets {
+			if n.Contains(ip) {
+				return nil
+			}
+		}
+	}
+	for _, d := range p.noProxyDomains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return nil
+		}
+	}
+
+	if (preferHTTP && p.httpURL != nil) || p.socks5URL == nil {
+		return p.httpURL
+	}
+
+	return p.socks5URL
+}
+
+func dialSOCKS5(ctx context.Context, d *net.Dialer, u *url.URL, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: pass}
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", proxyHostPort(u), auth, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+}
+
+// dialConnect opens a tunnel to addr with an HTTP CONNECT request.
+func dialConnect(ctx context.Context, d *net.Dialer, u *url.URL, addr string) (net.Conn, error) {
+	conn, err := d.DialContext(ctx, "tcp", proxyHostPort(u))
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if u.Scheme == "https" {
+		conf := api.NewTLSConfig()
+		conf.ServerName = u.Hostname()
+		conn = tls.Client(conn, conf)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("CONNECT responded with %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+
+	return conn, nil
+}
+
+// proxyHostPort returns the address of the proxy, adding the default port
+// of its scheme if the URL has none.
+func proxyHostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	port := "1080"
+	switch u.Scheme {
+	case "http":
+		port = "80"
+	case "https":
+		port = "443"
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// bufferedConn is a connection whose first bytes were already read into a
+// buffer.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
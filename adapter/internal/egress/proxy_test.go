@@ -0,0 +1,341 @@
+package egress_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/test_util"
+	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
+	"code.cloudfoundry.org/scalable-syslog/internal/testhelper"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Proxy", func() {
+	var (
+		listener *spyListener
+		cancel   context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		listener = newSpyListener()
+		cancel = func() {}
+	})
+
+	AfterEach(func() {
+		cancel()
+		listener.Close()
+	})
+
+	connect := func(p *egress.Proxy, opts []egress.ConnectorOption, drain string) egress.Writer {
+		connector := egress.NewSyslogConnector(
+			egress.NetworkTimeoutConfig{WriteTimeout: time.Second, DialTimeout: time.Second},
+			true,
+			&SpyWaitGroup{},
+			append(opts,
+				egress.WithEgressMetrics(map[string]pulseemitter.CounterMetric{
+					"syslog":     &testhelper.SpyMetric{},
+					"syslog-tls": &testhelper.SpyMetric{},
+					"https":      &testhelper.SpyMetric{},
+				}),
+				egress.WithProxy(p),
+			)...,
+		)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		w, err := connector.Connect(ctx, &v1.Binding{
+			AppId:    "app-id",
+			Hostname: "org.space.app",
+			Drain:    drain,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		return w
+	}
+
+	constructors := egress.WithConstructors(map[string]egress.WriterConstructor{
+		"syslog":     egress.NewTCPWriter,
+		"syslog-tls": egress.NewTLSWriter,
+		"https":      egress.NewHTTPSWriter,
+	})
+
+	write := func(w egress.Writer) {
+		Expect(w.Write(buildLogEnvelope("APP", "1", "hello", loggregator_v2.Log_OUT))).To(Succeed())
+	}
+
+	It("tunnels syslog drains through an HTTP CONNECT proxy", func() {
+		proxy := newSpyConnectProxy("user", "pass")
+		defer proxy.Close()
+		p, err := egress.NewProxy("http://user:pass@"+proxy.Addr().String(), "", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		write(connect(p, []egress.ConnectorOption{constructors}, fmt.Sprintf("syslog://%s?framing=lf", listener.Addr())))
+
+		Eventually(listener.lines).Should(ConsistOf(ContainSubstring("hello")))
+		Expect(proxy.targets()).To(ConsistOf(listener.Addr().String()))
+	})
+
+	It("tunnels syslog-tls drains through the proxy", func() {
+		certFile := test_util.Cert("adapter-rlp.crt")
+		keyFile := test_util.Cert("adapter-rlp.key")
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		Expect(err).ToNot(HaveOccurred())
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		tlsListener := &spyListener{
+			Listener: tls.NewListener(lis, &tls.Config{Certificates: []tls.Certificate{cert}}),
+		}
+		go tlsListener.serve()
+		defer tlsListener.Close()
+
+		proxy := newSpyConnectProxy("", "")
+		defer proxy.Close()
+		p, err := egress.NewProxy("http://"+proxy.Addr().String(), "", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		write(connect(p, []egress.ConnectorOption{constructors}, fmt.Sprintf("syslog-tls://%s?framing=lf", tlsListener.Addr())))
+
+		Eventually(tlsListener.lines).Should(ConsistOf(ContainSubstring("hello")))
+		Expect(proxy.targets()).To(ConsistOf(tlsListener.Addr().String()))
+	})
+
+	It("tunnels https drains through the HTTP proxy", func() {
+		bodies := make(chan string, 10)
+		drain := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies <- string(body)
+		}))
+		defer drain.Close()
+
+		proxy := newSpyConnectProxy("", "")
+		defer proxy.Close()
+		socks := newSpySOCKS5Proxy("", "")
+		defer socks.Close()
+		p, err := egress.NewProxy("http://"+proxy.Addr().String(), "socks5://"+socks.Addr().String(), nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		write(connect(p, []egress.ConnectorOption{constructors}, drain.URL))
+
+		Eventually(bodies, 5).Should(Receive(ContainSubstring("hello")))
+		Expect(proxy.targets()).To(ConsistOf(drain.Listener.Addr().String()))
+		Expect(socks.targets()).To(BeEmpty())
+	})
+
+	It("connects through a SOCKS5 proxy", func() {
+		socks := newSpySOCKS5Proxy("user", "pass")
+		defer socks.Close()
+		p, err := egress.NewProxy("", "socks5://user:pass@"+socks.Addr().String(), nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		write(connect(p, []egress.ConnectorOption{constructors}, fmt.Sprintf("syslog://%s?framing=lf", listener.Addr())))
+
+		Eventually(listener.lines).Should(ConsistOf(ContainSubstring("hello")))
+		Expect(socks.targets()).To(ConsistOf(listener.Addr().String()))
+	})
+
+	It("connects directly to hosts on the no-proxy list", func() {
+		proxy := newSpyConnectProxy("", "")
+		defer proxy.Close()
+		p, err := egress.NewProxy("http://"+proxy.Addr().String(), "", []string{"10.0.0.0/8", "127.0.0.0/8"})
+		Expect(err).ToNot(HaveOccurred())
+
+		write(connect(p, []egress.ConnectorOption{constructors}, fmt.Sprintf("syslog://%s?framing=lf", listener.Addr())))
+
+		Eventually(listener.lines).Should(HaveLen(1))
+		Expect(proxy.targets()).To(BeEmpty())
+	})
+
+	It("reports proxy failures to the app as proxy errors", func() {
+		proxy := newSpyConnectProxy("user", "pass")
+		defer proxy.Close()
+		p, err := egress.NewProxy("http://user:wrong@"+proxy.Addr().String(), "", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		logClient := newSpyLogClient()
+		retry := egress.RetryWrapper(egress.NewTCPWriter, func(int) time.Duration {
+			return time.Millisecond
+		}, 2, logClient, "0")
+		opts := []egress.ConnectorOption{
+			egress.WithConstructors(map[string]egress.WriterConstructor{"syslog": retry}),
+		}
+
+		write(connect(p, opts, fmt.Sprintf("syslog://%s", listener.Addr())))
+
+		Eventually(logClient.message).Should(ContainElement(
+			"Syslog Drain: Proxy error when writing. Backing off for 1ms.",
+		))
+		Expect(listener.accepted()).To(Equal(0))
+	})
+
+	DescribeTable("rejects invalid proxy config", func(httpProxy, socks5Proxy string, noProxy []string) {
+		_, err := egress.NewProxy(httpProxy, socks5Proxy, noProxy)
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("HTTP proxy with the wrong scheme", "socks5://proxy:1080", "", nil),
+		Entry("HTTP proxy without host", "http://", "", nil),
+		Entry("SOCKS5 proxy with the wrong scheme", "", "http://proxy:3128", nil),
+		Entry("invalid no-proxy entry", "http://proxy:3128", "", []string{"example.com/path"}),
+	)
+
+	It("returns nil without a proxy", func() {
+		p, err := egress.NewProxy("", "", []string{"example.com"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(BeNil())
+	})
+})
+
+// spyProxy records the targets clients asked it to connect to and tunnels
+// the connections to them.
+type spyProxy struct {
+	net.Listener
+	user, pass string
+
+	mu       sync.Mutex
+	_targets []string
+}
+
+func newSpyProxy(user, pass string, handshake func(*spyProxy, net.Conn) (io.Reader, string, bool)) *spyProxy {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+
+	p := &spyProxy{Listener: lis, user: user, pass: pass}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				r, target, ok := handshake(p, conn)
+				if !ok {
+					return
+				}
+				p.mu.Lock()
+				p._targets = append(p._targets, target)
+				p.mu.Unlock()
+
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+
+				go io.Copy(conn, upstream)
+				io.Copy(upstream, r)
+			}()
+		}
+	}()
+
+	return p
+}
+
+// newSpyConnectProxy returns an HTTP CONNECT proxy. If user is set clients
+// must authenticate with user and pass.
+func newSpyConnectProxy(user, pass string) *spyProxy {
+	return newSpyProxy(user, pass, func(p *spyProxy, conn net.Conn) (io.Reader, string, bool) {
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil || req.Method != http.MethodConnect {
+			return nil, "", false
+		}
+
+		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(p.user+":"+p.pass))
+		if p.user != "" && req.Header.Get("Proxy-Authorization") != auth {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			return nil, "", false
+		}
+
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		return br, req.Host, true
+	})
+}
+
+// newSpySOCKS5Proxy returns a SOCKS5 proxy that supports the CONNECT command.
+// If user is set clients must authenticate with user and pass.
+func newSpySOCKS5Proxy(user, pass string) *spyProxy {
+	return newSpyProxy(user, pass, func(p *spyProxy, conn net.Conn) (io.Reader, string, bool) {
+		read := func(n int) []byte {
+			b := make([]byte, n)
+			if _, err := io.ReadFull(conn, b); err != nil {
+				return nil
+			}
+			return b
+		}
+
+		greeting := read(2)
+		if greeting == nil || read(int(greeting[1])) == nil {
+			return nil, "", false
+		}
+
+		if p.user == "" {
+			conn.Write([]byte{5, 0})
+		} else {
+			conn.Write([]byte{5, 2})
+
+			header := read(2)
+			if header == nil {
+				return nil, "", false
+			}
+			u := read(int(header[1]))
+			plen := read(1)
+			if u == nil || plen == nil {
+				return nil, "", false
+			}
+			pw := read(int(plen[0]))
+			if string(u) != p.user || string(pw) != p.pass {
+				conn.Write([]byte{1, 1})
+				return nil, "", false
+			}
+			conn.Write([]byte{1, 0})
+		}
+
+		req := read(4)
+		if req == nil || req[1] != 1 {
+			return nil, "", false
+		}
+
+		var host string
+		switch req[3] {
+		case 1:
+			host = net.IP(read(4)).String()
+		case 3:
+			host = string(read(int(read(1)[0])))
+		case 4:
+			host = net.IP(read(16)).String()
+		default:
+			return nil, "", false
+		}
+		port := binary.BigEndian.Uint16(read(2))
+
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		return conn, net.JoinHostPort(host, strconv.Itoa(int(port))), true
+	})
+}
+
+func (p *spyProxy) targets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p._targets
+}
@@ -0,0 +1,274 @@
+package egress
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/golang/protobuf/proto"
+)
+
+// RedactionRule replaces the parts of log payloads that match Pattern with
+// Replacement. Replacement may refer to submatches as described by
+// regexp.Expand. Rules with Default set apply to every drain unless the
+// drain opts out with the no-redact query parameter. Other rules apply only
+// to drains that opt in with the redact query parameter.
+type RedactionRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Default     bool   `json:"default"`
+
+	re    *regexp.Regexp
+	check func(match []byte) bool
+}
+
+// redactionPresets are the rules that can be enabled by name alone.
+var redactionPresets = map[string]RedactionRule{
+	"pan": {
+		Pattern:     `\b(?:\d[ -]?){12,18}\d\b`,
+		Replacement: "[REDACTED-PAN]",
+		check:       luhnValid,
+	},
+	"email": {
+		Pattern:     `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+		Replacement: "[REDACTED-EMAIL]",
+	},
+	"jwt": {
+		Pattern:     `\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+		Replacement: "[REDACTED-JWT]",
+	},
+	"aws-key": {
+		Pattern:     `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+		Replacement: "[REDACTED-AWS-KEY]",
+	},
+	"bearer": {
+		Pattern:     `(?i)(bearer\s+)[A-Za-z0-9._~+/-]+=*`,
+		Replacement: "${1}[REDACTED]",
+	},
+}
+
+// LoadRedactionRules reads a JSON array of redaction rules from path. A rule
+// that names a preset (pan, email, jwt, aws-key or bearer) and has no
+// pattern uses the pattern of the preset. Replacements must not contain line
+// breaks or null bytes, so that redacted messages keep their framing.
+func LoadRedactionRules(path string) ([]RedactionRule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []RedactionRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" {
+			return nil, fmt.Errorf("redaction rule %d has no name", i)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("redaction rule %q is defined twice", r.Name)
+		}
+		seen[r.Name] = true
+
+		if p, ok := redactionPresets[r.Name]; ok && r.Pattern == "" {
+			r.Pattern = p.Pattern
+			r.check = p.check
+			if r.Replacement == "" {
+				r.Replacement = p.Replacement
+			}
+		}
+
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("redaction rule %q has no pattern", r.Name)
+		}
+		r.re, err = regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %q: %s", r.Name, err)
+		}
+		if strings.ContainsAny(r.Replacement, "\r\n\x00") {
+			return nil, fmt.Errorf("redaction rule %q: replacement contains a line break or null byte", r.Name)
+		}
+	}
+
+	return rules, nil
+}
+
+// redact returns b with every match of the rule replaced and the number of
+// replacements.
+func (r *RedactionRule) redact(b []byte) ([]byte, int) {
+	matches := r.re.FindAllSubmatchIndex(b, -1)
+	if len(matches) == 0 {
+		return b, 0
+	}
+
+	var out []byte
+	last, n := 0, 0
+	for _, m := range matches {
+		if r.check != nil && !r.check(b[m[0]:m[1]]) {
+			part, ok := r.checkedPart(b, m[0], m[1])
+			if !ok {
+				continue
+			}
+			m = part
+		}
+		out = append(out, b[last:m[0]]...)
+		out = r.re.Expand(out, []byte(r.Replacement), b, m)
+		last = m[1]
+		n++
+	}
+	if n == 0 {
+		return b, 0
+	}
+
+	return append(out, b[last:]...), n
+}
+
+// checkedPart returns the longest part of the match b[start:end] that starts
+// and ends at a separator or at the ends of the match and that on its own
+// matches the rule and passes its check. This finds a card number followed
+// or preceded by other digits, such as a CVV.
+func (r *RedactionRule) checkedPart(b []byte, start, end int) ([]int, bool) {
+	starts, ends := []int{start}, []int{end}
+	for i := start; i < end; i++ {
+		if !isAlphanumeric(b[i]) {
+			starts = append(starts, i+1)
+			ends = append(ends, i)
+		}
+	}
+
+	var part []int
+	for _, s := range starts {
+		for _, e := range ends {
+			if e <= s || (part != nil && e-s <= part[1]-part[0]) {
+				continue
+			}
+			loc := r.re.FindIndex(b[s:e])
+			if loc == nil || loc[0] != 0 || loc[1] != e-s || !r.check(b[s:e]) {
+				continue
+			}
+			part = []int{s, e}
+		}
+	}
+
+	return part, part != nil
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// redactionRulesFromURL returns the rules that apply to a drain: the default
+// rules and the ones named by the redact query parameter, without the ones
+// named by the no-redact query parameter. Unknown names are ignored.
+func redactionRulesFromURL(rules []RedactionRule, u *url.URL) []*RedactionRule {
+	optIn := queryList(u, "redact")
+	optOut := queryList(u, "no-redact")
+
+	var selected []*RedactionRule
+	for i := range rules {
+		r := &rules[i]
+		if (r.Default || optIn[r.Name]) && !optOut[r.Name] {
+			selected = append(selected, r)
+		}
+	}
+
+	return selected
+}
+
+func queryList(u *url.URL, param string) map[string]bool {
+	names := make(map[string]bool)
+	for _, v := range u.Query()[param] {
+		for _, n := range strings.Split(v, ",") {
+			names[strings.TrimSpace(n)] = true
+		}
+	}
+
+	return names
+}
+
+// redactingWriter redacts the payload of log envelopes before passing them
+// on. It sits in front of the diode so that envelopes are redacted before
+// they are held in memory or spilled to disk.
+type redactingWriter struct {
+	Writer
+	rules  []*RedactionRule
+	metric pulseemitter.CounterMetric
+}
+
+func newRedactingWriter(w Writer, rules []*RedactionRule, metric pulseemitter.CounterMetric) Writer {
+	if len(rules) == 0 {
+		return w
+	}
+
+	return &redactingWriter{
+		Writer: w,
+		rules:  rules,
+		metric: metric,
+	}
+}
+
+// Write redacts a copy of the envelope so that retries of the wrapped writer
+// and other bindings of the app are not affected.
+func (w *redactingWriter) Write(env *loggregator_v2.Envelope) error {
+	if env.GetLog() == nil {
+		return w.Writer.Write(env)
+	}
+
+	payload := env.GetLog().GetPayload()
+	total := 0
+	for _, r := range w.rules {
+		var n int
+		payload, n = r.redact(payload)
+		total += n
+	}
+
+	if total == 0 {
+		return w.Writer.Write(env)
+	}
+
+	if w.metric != nil {
+		w.metric.Increment(uint64(total))
+	}
+
+	redacted := proto.Clone(env).(*loggregator_v2.Envelope)
+	redacted.GetLog().Payload = payload
+
+	return w.Writer.Write(redacted)
+}
+
+// luhnValid reports whether the digits in b pass the Luhn check used by card
+// numbers. Spaces and hyphens are ignored.
+func luhnValid(b []byte) bool {
+	digits := bytes.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, b)
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
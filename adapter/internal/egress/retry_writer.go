@@ -1,9 +1,11 @@
 package egress
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math"
+	"math/rand"
 	"time"
 
 	loggregator "code.cloudfoundry.org/go-loggregator"
@@ -18,6 +20,18 @@ func RetryWrapper(
 	maxRetries int,
 	logClient LogClient,
 	sourceIndex string,
+) WriterConstructor {
+	return RetryStrategyWrapper(wc, func() RetryDuration { return r }, maxRetries, logClient, sourceIndex)
+}
+
+// RetryStrategyWrapper wraps a WriterConstructor like RetryWrapper. Every
+// writer gets its own RetryDuration from the strategy.
+func RetryStrategyWrapper(
+	wc WriterConstructor,
+	s RetryStrategy,
+	maxRetries int,
+	logClient LogClient,
+	sourceIndex string,
 ) WriterConstructor {
 	return WriterConstructor(func(
 		binding *URLBinding,
@@ -34,7 +48,7 @@ func RetryWrapper(
 
 		return &RetryWriter{
 			writer:        writer,
-			retryDuration: r,
+			retryDuration: s(),
 			maxRetries:    maxRetries,
 			binding:       binding,
 			logClient:     logClient,
@@ -46,6 +60,10 @@ func RetryWrapper(
 // RetryDuration calculates a duration based on the number of write attempts.
 type RetryDuration func(attempt int) time.Duration
 
+// RetryStrategy returns the RetryDuration of a single writer. Strategies
+// that depend on the previous duration keep it in the RetryDuration.
+type RetryStrategy func() RetryDuration
+
 // RetryWriter wraps a WriteCloser and will retry writes if the first fails.
 type RetryWriter struct {
 	writer        WriteCloser
@@ -56,7 +74,9 @@ type RetryWriter struct {
 	sourceIndex   string
 }
 
-// Write will retry writes unitl maxRetries has been reached.
+// Write will retry writes unitl maxRetries has been reached. It gives up
+// immediately when the circuit breaker of the drain is open. Failures to
+// connect through the proxy are reported to the app as proxy errors.
 func (r *RetryWriter) Write(e *loggregator_v2.Envelope) error {
 	logMsgOption := loggregator.WithAppInfo(
 		r.binding.AppID,
@@ -64,6 +84,7 @@ func (r *RetryWriter) Write(e *loggregator_v2.Envelope) error {
 		r.sourceIndex,
 	)
 	logMsgTemplate := "Syslog Drain: Error when writing. Backing off for %s."
+	proxyLogMsgTemplate := "Syslog Drain: Proxy error when writing. Backing off for %s."
 	logTemplate := "failed to write to %s, retrying in %s, err: %s"
 
 	var err error
@@ -74,16 +95,21 @@ func (r *RetryWriter) Write(e *loggregator_v2.Envelope) error {
 			return nil
 		}
 
-		if contextDone(r.binding.Context) {
+		if err == ErrCircuitOpen || contextDone(r.binding.Context) {
 			return err
 		}
 
 		sleepDuration := r.retryDuration(i)
 		log.Printf(logTemplate, r.binding.URL.Host, sleepDuration, err)
 		msg := fmt.Sprintf(logMsgTemplate, sleepDuration)
+		if isProxyError(err) {
+			msg = fmt.Sprintf(proxyLogMsgTemplate, sleepDuration)
+		}
 		r.logClient.EmitLog(msg, logMsgOption)
 
-		time.Sleep(sleepDuration)
+		if !sleep(r.binding.Context, sleepDuration) {
+			return err
+		}
 	}
 
 	return err
@@ -94,6 +120,42 @@ func (r *RetryWriter) Close() error {
 	return r.writer.Close()
 }
 
+// sleep waits for the duration or until the context is done. It returns
+// false if the context is done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+const (
+	retryBaseDuration = time.Millisecond
+	retryMaxDuration  = 15 * time.Second
+	retryLinearStep   = time.Second
+)
+
+// RetryStrategies maps the names of the available retry strategies to
+// their RetryStrategy.
+var RetryStrategies = map[string]RetryStrategy{
+	"exponential":         stateless(ExponentialDuration),
+	"full-jitter":         stateless(FullJitterDuration),
+	"decorrelated-jitter": NewDecorrelatedJitterDuration,
+	"linear":              stateless(CappedLinearDuration),
+}
+
+// stateless returns a RetryStrategy that shares r between all writers.
+func stateless(r RetryDuration) RetryStrategy {
+	return func() RetryDuration {
+		return r
+	}
+}
+
 // ExponentialDuration returns a duration that grows exponentially with each
 // attempt. It is maxed out at 15 seconds.
 func ExponentialDuration(attempt int) time.Duration {
@@ -110,3 +172,48 @@ func ExponentialDuration(attempt int) time.Duration {
 
 	return duration
 }
+
+// FullJitterDuration returns a random duration between zero and the
+// ExponentialDuration of the attempt. This spreads out writers that started
+// failing at the same time.
+func FullJitterDuration(attempt int) time.Duration {
+	return time.Duration(rand.Int63n(int64(ExponentialDuration(attempt)) + 1))
+}
+
+// NewDecorrelatedJitterDuration returns a RetryDuration that draws a random
+// duration between the base duration and three times the duration it
+// returned before, maxed out at 15 seconds. The first attempt starts over
+// from the base duration. The RetryDuration must not be shared between
+// writers.
+func NewDecorrelatedJitterDuration() RetryDuration {
+	prev := retryBaseDuration
+
+	return func(attempt int) time.Duration {
+		if attempt == 0 {
+			prev = retryBaseDuration
+			return prev
+		}
+
+		prev = retryBaseDuration + time.Duration(rand.Int63n(int64(3*prev-retryBaseDuration)+1))
+		if prev > retryMaxDuration {
+			prev = retryMaxDuration
+		}
+
+		return prev
+	}
+}
+
+// CappedLinearDuration returns a duration that grows by one second with each
+// attempt. It is maxed out at 15 seconds.
+func CappedLinearDuration(attempt int) time.Duration {
+	if attempt == 0 {
+		return retryBaseDuration
+	}
+
+	d := time.Duration(attempt) * retryLinearStep
+	if d > retryMaxDuration {
+		return retryMaxDuration
+	}
+
+	return d
+}
@@ -90,6 +90,49 @@ var _ = Describe("Retry Writer", func() {
 			Expect(writeCloser.WriteAttempts()).To(Equal(1))
 		})
 
+		It("stops retrying when the circuit breaker is open", func() {
+			writeCloser := &spyWriteCloser{
+				returnErrCount: 3,
+				writeErr:       egress.ErrCircuitOpen,
+				binding: &egress.URLBinding{
+					URL:     &url.URL{},
+					Context: context.Background(),
+				},
+			}
+			logClient := newSpyLogClient()
+			r := buildRetryWriter(writeCloser, 3, 0, logClient, "1")
+
+			err := r.Write(&v2.Envelope{})
+
+			Expect(err).To(Equal(egress.ErrCircuitOpen))
+			Expect(writeCloser.WriteAttempts()).To(Equal(1))
+			Expect(logClient.message()).To(BeEmpty())
+		})
+
+		It("stops backing off when the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			writeCloser := &spyWriteCloser{
+				returnErrCount: 3,
+				writeErr:       errors.New("write error"),
+				binding: &egress.URLBinding{
+					URL:     &url.URL{},
+					Context: ctx,
+				},
+			}
+			logClient := newSpyLogClient()
+			r := buildRetryWriter(writeCloser, 3, time.Hour, logClient, "1")
+
+			errs := make(chan error)
+			go func() {
+				errs <- r.Write(&v2.Envelope{})
+			}()
+			Eventually(writeCloser.WriteAttempts).Should(Equal(2))
+			cancel()
+
+			Eventually(errs).Should(Receive(HaveOccurred()))
+			Expect(writeCloser.WriteAttempts()).To(Equal(2))
+		})
+
 		It("writes out the LGR message", func() {
 			writeCloser := &spyWriteCloser{
 				returnErrCount: 1,
@@ -153,6 +196,53 @@ var _ = Describe("Retry Writer", func() {
 			}
 		})
 	})
+
+	Describe("FullJitterDuration", func() {
+		It("stays between zero and the exponential backoff", func() {
+			for attempt := 0; attempt < 22; attempt++ {
+				backoff := egress.FullJitterDuration(attempt)
+
+				Expect(backoff).To(BeNumerically(">=", 0))
+				Expect(backoff).To(BeNumerically("<=", egress.ExponentialDuration(attempt)))
+			}
+		})
+	})
+
+	Describe("NewDecorrelatedJitterDuration", func() {
+		It("stays between 1ms and three times the previous duration", func() {
+			retryDuration := egress.NewDecorrelatedJitterDuration()
+			prev := retryDuration(0)
+			Expect(prev).To(Equal(time.Millisecond))
+
+			for attempt := 1; attempt < 22; attempt++ {
+				backoff := retryDuration(attempt)
+
+				Expect(backoff).To(BeNumerically(">=", time.Millisecond))
+				Expect(backoff).To(BeNumerically("<=", 3*prev))
+				Expect(backoff).To(BeNumerically("<=", 15*time.Second))
+				prev = backoff
+			}
+		})
+
+		It("starts over with the first attempt", func() {
+			retryDuration := egress.NewDecorrelatedJitterDuration()
+			for attempt := 0; attempt < 10; attempt++ {
+				retryDuration(attempt)
+			}
+
+			Expect(retryDuration(0)).To(Equal(time.Millisecond))
+			Expect(retryDuration(1)).To(BeNumerically("<=", 3*time.Millisecond))
+		})
+	})
+
+	Describe("CappedLinearDuration", func() {
+		It("grows by a second with each attempt up to 15s", func() {
+			Expect(egress.CappedLinearDuration(0)).To(Equal(time.Millisecond))
+			Expect(egress.CappedLinearDuration(1)).To(Equal(time.Second))
+			Expect(egress.CappedLinearDuration(5)).To(Equal(5 * time.Second))
+			Expect(egress.CappedLinearDuration(20)).To(Equal(15 * time.Second))
+		})
+	})
 })
 
 type spyWriteCloser struct {
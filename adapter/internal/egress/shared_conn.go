@@ -0,0 +1,166 @@
+package egress
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// connectionPool shares syslog and syslog-tls connections between bindings
+// that write to the same destination with the same settings. Each
+// destination gets up to size connections and bindings are spread over
+// them. A connection is closed once the last binding using it is closed.
+type connectionPool struct {
+	size int
+
+	mu    sync.Mutex
+	conns map[string][]*sharedConn
+}
+
+func newConnectionPool(size int) *connectionPool {
+	return &connectionPool{
+		size:  size,
+		conns: make(map[string][]*sharedConn),
+	}
+}
+
+// acquire returns the connection of the destination with the fewest
+// bindings, or a new one if the destination has less than size connections.
+// dial is used to connect to addr.
+func (p *connectionPool) acquire(key, addr string, dial DialFunc) *sharedConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var least *sharedConn
+	for _, c := range p.conns[key] {
+		if least == nil || c.refs < least.refs {
+			least = c
+		}
+	}
+
+	if least == nil || (least.refs > 0 && len(p.conns[key]) < p.size) {
+		least = &sharedConn{
+			pool: p,
+			key:  key,
+			addr: addr,
+			dial: dial,
+		}
+		p.conns[key] = append(p.conns[key], least)
+	}
+	least.refs++
+
+	return least
+}
+
+// release drops a reference to the connection and closes it when it was the
+// last one.
+func (p *connectionPool) release(c *sharedConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c.refs--
+	if c.refs > 0 {
+		return
+	}
+
+	conns := p.conns[c.key]
+	for i, other := range conns {
+		if other == c {
+			conns = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(conns) == 0 {
+		delete(p.conns, c.key)
+	} else {
+		p.conns[c.key] = conns
+	}
+
+	c.close()
+}
+
+// sharedConn is a connection written to by several bindings. Writes of
+// different bindings are serialized so that messages are not interleaved.
+type sharedConn struct {
+	pool *connectionPool
+	key  string
+	addr string
+	dial DialFunc
+
+	// refs is guarded by pool.mu.
+	refs int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// write writes the framed messages and returns how many were written. The
+// connection is dialed if needed and closed on errors, so that the next
+// write reconnects.
+func (c *sharedConn) write(msgs [][]byte, timeout time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		conn, err := c.dial(c.addr)
+		if err != nil {
+			return 0, err
+		}
+		c.conn = conn
+
+		log.Printf("created shared conn to syslog drain: %s", c.addr)
+	}
+
+	for i, b := range msgs {
+		c.conn.SetWriteDeadline(time.Now().Add(timeout))
+		if _, err := c.conn.Write(b); err != nil {
+			c.conn.Close()
+			c.conn = nil
+
+			return i, err
+		}
+	}
+
+	return len(msgs), nil
+}
+
+func (c *sharedConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// acquireSharedConn returns a shared connection for the binding if
+// connection sharing is enabled for it, and nil otherwise.
+func acquireSharedConn(b *URLBinding, skipCertVerify bool, dial DialFunc) *sharedConn {
+	if b.connPool == nil {
+		return nil
+	}
+
+	return b.connPool.acquire(sharedConnKey(b, skipCertVerify), b.URL.Host, dial)
+}
+
+// sharedConnKey identifies the destination of a binding together with the
+// settings that must match for bindings to share a connection.
+func sharedConnKey(b *URLBinding, skipCertVerify bool) string {
+	q := b.URL.Query()
+
+	return strings.Join([]string{
+		b.Scheme(),
+		b.URL.Host,
+		q.Get("framing"),
+		q.Get("format"),
+		q.Get("ca"),
+		q.Get("servername"),
+		b.ClientCertFile,
+		b.ClientKeyFile,
+		strconv.FormatBool(skipCertVerify),
+	}, "\x00")
+}
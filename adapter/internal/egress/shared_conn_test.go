@@ -0,0 +1,196 @@
+package egress_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
+	"code.cloudfoundry.org/scalable-syslog/internal/testhelper"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Shared connections", func() {
+	var (
+		listener *spyListener
+		metrics  map[string]*testhelper.SpyMetric
+	)
+
+	BeforeEach(func() {
+		listener = newSpyListener()
+		metrics = make(map[string]*testhelper.SpyMetric)
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	newConnector := func(size int) *egress.SyslogConnector {
+		var mu sync.Mutex
+		constructor := func(
+			b *egress.URLBinding,
+			netConf egress.NetworkTimeoutConfig,
+			skipCertVerify bool,
+			_ pulseemitter.CounterMetric,
+		) egress.WriteCloser {
+			mu.Lock()
+			defer mu.Unlock()
+			m := &testhelper.SpyMetric{}
+			metrics[b.AppID] = m
+
+			return egress.NewTCPWriter(b, netConf, skipCertVerify, m)
+		}
+
+		return egress.NewSyslogConnector(
+			egress.NetworkTimeoutConfig{WriteTimeout: time.Second},
+			true,
+			&SpyWaitGroup{},
+			egress.WithConstructors(map[string]egress.WriterConstructor{
+				"syslog": constructor,
+			}),
+			egress.WithSharedConnections(size),
+		)
+	}
+
+	connect := func(connector *egress.SyslogConnector, appID, query string) (egress.Writer, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		w, err := connector.Connect(ctx, &v1.Binding{
+			AppId:    appID,
+			Hostname: "org.space." + appID,
+			Drain:    fmt.Sprintf("syslog://%s?framing=lf%s", listener.Addr(), query),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		return w, cancel
+	}
+
+	It("multiplexes bindings of the same destination onto one connection", func() {
+		connector := newConnector(1)
+		w1, cancel1 := connect(connector, "app-1", "")
+		w2, cancel2 := connect(connector, "app-2", "")
+
+		Expect(w1.Write(buildLogEnvelope("APP", "1", "from app 1", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(w2.Write(buildLogEnvelope("APP", "1", "from app 2", loggregator_v2.Log_OUT))).To(Succeed())
+
+		Eventually(listener.lines).Should(HaveLen(2))
+		Expect(listener.lines()).To(ConsistOf(
+			ContainSubstring("org.space.app-1 app-1"),
+			ContainSubstring("org.space.app-2 app-2"),
+		))
+		Expect(listener.accepted()).To(Equal(1))
+		Eventually(metrics["app-1"].Delta).Should(Equal(uint64(1)))
+		Eventually(metrics["app-2"].Delta).Should(Equal(uint64(1)))
+
+		cancel1()
+		Expect(w2.Write(buildLogEnvelope("APP", "1", "still there", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(listener.lines).Should(HaveLen(3))
+		Expect(listener.accepted()).To(Equal(1))
+
+		cancel2()
+		Eventually(listener.closed).Should(Equal(1))
+	})
+
+	It("spreads bindings over the pool", func() {
+		connector := newConnector(2)
+		for i := 0; i < 4; i++ {
+			w, cancel := connect(connector, fmt.Sprintf("app-%d", i), "")
+			defer cancel()
+			Expect(w.Write(buildLogEnvelope("APP", "1", "hello", loggregator_v2.Log_OUT))).To(Succeed())
+		}
+
+		Eventually(listener.lines).Should(HaveLen(4))
+		Expect(listener.accepted()).To(Equal(2))
+	})
+
+	It("does not share connections between bindings with different settings", func() {
+		connector := newConnector(1)
+		w1, cancel1 := connect(connector, "app-1", "")
+		defer cancel1()
+		w2, cancel2 := connect(connector, "app-2", "&format=rfc3164")
+		defer cancel2()
+
+		Expect(w1.Write(buildLogEnvelope("APP", "1", "hello", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(w2.Write(buildLogEnvelope("APP", "1", "hello", loggregator_v2.Log_OUT))).To(Succeed())
+
+		Eventually(listener.lines).Should(HaveLen(2))
+		Expect(listener.accepted()).To(Equal(2))
+	})
+})
+
+// spyListener is a syslog server that records the lines it receives and
+// counts the connections it accepted and saw closed.
+type spyListener struct {
+	net.Listener
+
+	mu        sync.Mutex
+	_lines    []string
+	_accepted int
+	_closed   int
+}
+
+func newSpyListener() *spyListener {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+
+	l := &spyListener{Listener: lis}
+	go l.serve()
+
+	return l
+}
+
+func (l *spyListener) serve() {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		l.mu.Lock()
+		l._accepted++
+		l.mu.Unlock()
+
+		go func() {
+			defer conn.Close()
+
+			s := bufio.NewScanner(conn)
+			for s.Scan() {
+				l.mu.Lock()
+				l._lines = append(l._lines, s.Text())
+				l.mu.Unlock()
+			}
+
+			l.mu.Lock()
+			l._closed++
+			l.mu.Unlock()
+		}()
+	}
+}
+
+func (l *spyListener) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l._lines
+}
+
+func (l *spyListener) accepted() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l._accepted
+}
+
+func (l *spyListener) closed() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l._closed
+}
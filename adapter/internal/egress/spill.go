@@ -0,0 +1,627 @@
+package egress
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+const (
+	// spillSegmentSize is the size after which a new segment file is
+	// started. Segments are deleted once they have been replayed.
+	spillSegmentSize = 1024 * 1024
+
+	// spillRetention is how long the spill directory of a binding is kept
+	// around without being written to. This cleans up after bindings that
+	// were removed while their drain was down.
+	spillRetention = 24 * time.Hour
+
+	// spillFirstSegment leaves room for segments to be prepended.
+	spillFirstSegment = 1 << 32
+
+	// spillHandoverTimeout bounds how long a new connection of a binding
+	// waits for the writer of the previous connection to close its queue.
+	spillHandoverTimeout = 10 * time.Second
+
+	spillSegmentExt = ".seg"
+	spillCursorFile = "cursor"
+)
+
+// ErrSpillFull is returned when an envelope does not fit into the per-binding
+// or adapter-wide disk quota.
+var ErrSpillFull = errors.New("spill quota exhausted")
+
+// SpillStore manages the on-disk spill queues of all bindings and enforces
+// the adapter-wide disk quota.
+type SpillStore struct {
+	dir             string
+	maxBindingBytes int64
+	maxTotalBytes   int64
+
+	mu         sync.Mutex
+	totalBytes int64
+	open       map[string]chan struct{}
+	removed    map[string]bool
+}
+
+// NewSpillStore creates the spill directory if needed and accounts for the
+// segments left behind by a previous run. Queues that have not been written
+// to for a day are removed.
+func NewSpillStore(dir string, maxBindingBytes, maxTotalBytes int64) (*SpillStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &SpillStore{
+		dir:             dir,
+		maxBindingBytes: maxBindingBytes,
+		maxTotalBytes:   maxTotalBytes,
+		open:            make(map[string]chan struct{}),
+		removed:         make(map[string]bool),
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		if time.Since(e.ModTime()) > spillRetention {
+			log.Printf("removing stale spill queue %s", path)
+			os.RemoveAll(path)
+			continue
+		}
+
+		size, err := dirSize(path)
+		if err != nil {
+			return nil, err
+		}
+		s.totalBytes += size
+	}
+
+	return s, nil
+}
+
+// Open returns the spill queue of the binding. Envelopes spilled by a
+// previous run for the same app and drain URL are replayed first. Only one
+// queue per binding can be open at a time.
+func (s *SpillStore) Open(b *URLBinding) (*SpillQueue, error) {
+	q, closed, err := s.tryOpen(b, 0)
+	if closed != nil {
+		return nil, fmt.Errorf("spill queue for %s is already open", b.URL.Host)
+	}
+
+	return q, err
+}
+
+// openConnection returns the spill queue of one of the parallel connections
+// of the binding. The first connection uses the queue of the binding so that
+// envelopes spilled before connections was set are still replayed. When a
+// binding reconnects the writer of the previous connection still holds the
+// queue until it has saved what is left in memory, so openConnection waits
+// for it to close the queue until ctx is done or spillHandoverTimeout has
+// passed.
+func (s *SpillStore) openConnection(ctx context.Context, b *URLBinding, i int) (*SpillQueue, error) {
+	timer := time.NewTimer(spillHandoverTimeout)
+	defer timer.Stop()
+
+	for {
+		q, closed, err := s.tryOpen(b, i)
+		if closed == nil {
+			return q, err
+		}
+
+		select {
+		case <-closed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, fmt.Errorf("spill queue for %s is already open", b.URL.Host)
+		}
+	}
+}
+
+// tryOpen opens the queue of a connection of the binding. If the queue is
+// already open it returns a channel that is closed once it is closed.
+func (s *SpillStore) tryOpen(b *URLBinding, i int) (*SpillQueue, <-chan struct{}, error) {
+	key := spillConnectionKey(b, i)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if closed, ok := s.open[key]; ok {
+		return nil, closed, nil
+	}
+
+	dir := filepath.Join(s.dir, key)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+
+	q := &SpillQueue{
+		store: s,
+		key:   key,
+		dir:   dir,
+	}
+	if err := q.load(); err != nil {
+		return nil, nil, err
+	}
+	s.open[key] = make(chan struct{})
+
+	return q, nil, nil
+}
+
+// remove deletes the spill queues of the n connections of a binding that was
+// removed from the adapter. Queues that are still open are deleted once they
+// are closed.
+func (s *SpillStore) remove(b *URLBinding, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		key := spillConnectionKey(b, i)
+		if _, ok := s.open[key]; ok {
+			s.removed[key] = true
+			continue
+		}
+
+		dir := filepath.Join(s.dir, key)
+		size, err := dirSize(dir)
+		if err != nil {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("failed to remove spill queue %s: %s", dir, err)
+			continue
+		}
+		s.totalBytes -= size
+	}
+}
+
+func (s *SpillStore) reserve(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.totalBytes+n > s.maxTotalBytes {
+		return false
+	}
+	s.totalBytes += n
+
+	return true
+}
+
+func (s *SpillStore) release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totalBytes -= n
+}
+
+// closeQueue returns true if the binding of the queue was removed while it
+// was open.
+func (s *SpillStore) closeQueue(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := s.removed[key]
+	delete(s.removed, key)
+
+	return removed
+}
+
+// closed marks the queue as closed once its files are saved and wakes up
+// connections waiting to open it.
+func (s *SpillStore) closed(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if closed, ok := s.open[key]; ok {
+		close(closed)
+		delete(s.open, key)
+	}
+}
+
+// SpillQueue is a FIFO of envelopes stored in segment files on disk. Each
+// record is a 4 byte big endian length followed by the marshaled envelope.
+// The read offset is tracked per segment so that segments prepended in
+// front of a partially read one do not cause it to be read again. Replay is
+// at least once: the read offsets are only saved on Close.
+type SpillQueue struct {
+	store *SpillStore
+	key   string
+	dir   string
+
+	mu       sync.Mutex
+	segments []uint64
+	sizes    map[uint64]int64
+	offsets  map[uint64]int64
+	bytes    int64
+
+	w    *os.File
+	wSeq uint64
+
+	r       *os.File
+	rSeq    uint64
+	peekSeq uint64
+	peeked  int64
+}
+
+// Empty reports whether there are envelopes on disk.
+func (q *SpillQueue) Empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.segments) == 0
+}
+
+// Append adds an envelope to the end of the queue.
+func (q *SpillQueue) Append(env *loggregator_v2.Envelope) error {
+	rec, err := spillRecord(env)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.w == nil || q.sizes[q.wSeq]+int64(len(rec)) > spillSegmentSize {
+		seq := uint64(spillFirstSegment)
+		if len(q.segments) > 0 {
+			seq = q.segments[len(q.segments)-1] + 1
+		}
+
+		if err := q.startSegment(seq); err != nil {
+			return err
+		}
+		q.segments = append(q.segments, seq)
+	}
+
+	return q.write(q.w, q.wSeq, rec)
+}
+
+// Prepend adds envelopes to the front of the queue, keeping their order. It
+// is used to save envelopes that were still in memory when the writer shut
+// down. It returns the number of envelopes that did not fit.
+func (q *SpillQueue) Prepend(envs []*loggregator_v2.Envelope) (int, error) {
+	if len(envs) == 0 {
+		return 0, nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	seq := uint64(spillFirstSegment)
+	if len(q.segments) > 0 {
+		seq = q.segments[0] - 1
+	}
+
+	f, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return len(envs), err
+	}
+	defer f.Close()
+	q.segments = append([]uint64{seq}, q.segments...)
+
+	for i, env := range envs {
+		rec, err := spillRecord(env)
+		if err != nil {
+			return len(envs) - i, err
+		}
+
+		if err := q.write(f, seq, rec); err != nil {
+			return len(envs) - i, err
+		}
+	}
+
+	return 0, nil
+}
+
+// Next returns the envelope at the front of the queue without removing it,
+// or nil if the queue is empty. Call Ack once the envelope has been written.
+func (q *SpillQueue) Next() (*loggregator_v2.Envelope, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.segments) > 0 {
+		if err := q.openHead(); err != nil {
+			return nil, err
+		}
+
+		env, n, err := q.readAt(q.offsets[q.rSeq])
+		if err == nil {
+			q.peekSeq = q.rSeq
+			q.peeked = n
+			return env, nil
+		}
+
+		if q.rSeq == q.wSeq && q.w != nil {
+			// Nothing has been appended to the current segment yet.
+			return nil, nil
+		}
+
+		if q.offsets[q.rSeq] < q.sizes[q.rSeq] {
+			log.Printf("discarding corrupt spill segment %s: %s", q.segmentPath(q.rSeq), err)
+		}
+		q.removeSegment(q.rSeq)
+	}
+
+	return nil, nil
+}
+
+// Ack removes the envelope returned by the last call to Next.
+func (q *SpillQueue) Ack() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.peeked == 0 {
+		return
+	}
+
+	seq := q.peekSeq
+	q.offsets[seq] += q.peeked
+	q.peeked = 0
+
+	if size, ok := q.sizes[seq]; ok && q.offsets[seq] >= size {
+		q.removeSegment(seq)
+	}
+}
+
+// Close saves the read offsets so a later Open continues where this queue
+// stopped. If the binding was removed in the meantime the queue is deleted.
+func (q *SpillQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer q.store.closed(q.key)
+
+	if q.w != nil {
+		q.w.Close()
+		q.w = nil
+	}
+	if q.r != nil {
+		q.r.Close()
+		q.r = nil
+	}
+
+	if q.store.closeQueue(q.key) {
+		q.store.release(q.bytes)
+		q.bytes = 0
+		q.segments = nil
+
+		return os.RemoveAll(q.dir)
+	}
+
+	var cursor bytes.Buffer
+	for _, seq := range q.segments {
+		if off := q.offsets[seq]; off > 0 {
+			fmt.Fprintf(&cursor, "%d %d\n", seq, off)
+		}
+	}
+
+	path := filepath.Join(q.dir, spillCursorFile)
+	if cursor.Len() == 0 {
+		os.Remove(path)
+		return nil
+	}
+
+	return ioutil.WriteFile(path, cursor.Bytes(), 0600)
+}
+
+func (q *SpillQueue) load() error {
+	entries, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+
+	q.sizes = make(map[uint64]int64)
+	q.offsets = make(map[uint64]int64)
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, spillSegmentExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spillSegmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+
+		q.segments = append(q.segments, seq)
+		q.sizes[seq] = e.Size()
+		q.bytes += e.Size()
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	b, err := ioutil.ReadFile(filepath.Join(q.dir, spillCursorFile))
+	if err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			var (
+				seq uint64
+				off int64
+			)
+			if n, _ := fmt.Sscanf(line, "%d %d", &seq, &off); n == 2 {
+				if _, ok := q.sizes[seq]; ok {
+					q.offsets[seq] = off
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (q *SpillQueue) startSegment(seq uint64) error {
+	if q.w != nil {
+		q.w.Close()
+	}
+
+	f, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		q.w = nil
+		return err
+	}
+	q.w = f
+	q.wSeq = seq
+	q.sizes[seq] = 0
+
+	return nil
+}
+
+// write must be called with the mutex held.
+func (q *SpillQueue) write(f *os.File, seq uint64, rec []byte) error {
+	n := int64(len(rec))
+	if q.bytes+n > q.store.maxBindingBytes || !q.store.reserve(n) {
+		return ErrSpillFull
+	}
+
+	if _, err := f.Write(rec); err != nil {
+		q.store.release(n)
+		return err
+	}
+	q.bytes += n
+	q.sizes[seq] += n
+
+	return nil
+}
+
+// openHead must be called with the mutex held.
+func (q *SpillQueue) openHead() error {
+	head := q.segments[0]
+	if q.r != nil && q.rSeq == head {
+		return nil
+	}
+
+	if q.r != nil {
+		q.r.Close()
+	}
+
+	f, err := os.Open(q.segmentPath(head))
+	if err != nil {
+		q.r = nil
+		return err
+	}
+	q.r = f
+	q.rSeq = head
+
+	return nil
+}
+
+// readAt must be called with the mutex held.
+func (q *SpillQueue) readAt(offset int64) (*loggregator_v2.Envelope, int64, error) {
+	var hdr [4]byte
+	if _, err := q.r.ReadAt(hdr[:], offset); err != nil {
+		return nil, 0, err
+	}
+
+	size := binary.BigEndian.Uint32(hdr[:])
+	buf := make([]byte, size)
+	if _, err := q.r.ReadAt(buf, offset+4); err != nil {
+		return nil, 0, err
+	}
+
+	var env loggregator_v2.Envelope
+	if err := proto.Unmarshal(buf, &env); err != nil {
+		return nil, 0, err
+	}
+
+	return &env, int64(len(hdr)) + int64(size), nil
+}
+
+// removeSegment deletes a segment that has been read. It must be called
+// with the mutex held.
+func (q *SpillQueue) removeSegment(seq uint64) {
+	if q.r != nil && q.rSeq == seq {
+		q.r.Close()
+		q.r = nil
+	}
+	if q.w != nil && q.wSeq == seq {
+		q.w.Close()
+		q.w = nil
+	}
+
+	os.Remove(q.segmentPath(seq))
+	q.store.release(q.sizes[seq])
+	q.bytes -= q.sizes[seq]
+	delete(q.sizes, seq)
+	delete(q.offsets, seq)
+
+	for i, s := range q.segments {
+		if s == seq {
+			q.segments = append(q.segments[:i], q.segments[i+1:]...)
+			break
+		}
+	}
+	if q.peekSeq == seq {
+		q.peeked = 0
+	}
+}
+
+func (q *SpillQueue) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%016x%s", seq, spillSegmentExt))
+}
+
+func spillRecord(env *loggregator_v2.Envelope) ([]byte, error) {
+	b, err := proto.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(rec, uint32(len(b)))
+
+	return append(rec, b...), nil
+}
+
+// spillConnectionKey names the spill directory of connection i of a
+// binding.
+func spillConnectionKey(b *URLBinding, i int) string {
+	key := spillKey(b)
+	if i > 0 {
+		key += "-" + strconv.Itoa(i)
+	}
+
+	return key
+}
+
+// spillKey names the spill directory of a binding. The drain URL is hashed
+// since it may contain credentials.
+func spillKey(b *URLBinding) string {
+	sum := sha256.Sum256([]byte(b.AppID + " " + b.URL.String()))
+
+	return hex.EncodeToString(sum[:16])
+}
+
+func dirSize(dir string) (int64, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), spillSegmentExt) {
+			size += e.Size()
+		}
+	}
+
+	return size, nil
+}
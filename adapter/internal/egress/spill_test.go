@@ -0,0 +1,304 @@
+package egress_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SpillQueue", func() {
+	var (
+		dir     string
+		binding *egress.URLBinding
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "spill")
+		Expect(err).ToNot(HaveOccurred())
+
+		u, _ := url.Parse("syslog://some-host:123")
+		binding = &egress.URLBinding{
+			AppID:   "some-app-id",
+			URL:     u,
+			Context: context.Background(),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	openQueue := func(store *egress.SpillStore) *egress.SpillQueue {
+		q, err := store.Open(binding)
+		Expect(err).ToNot(HaveOccurred())
+
+		return q
+	}
+
+	readAll := func(q *egress.SpillQueue) []string {
+		var ids []string
+		for {
+			env, err := q.Next()
+			Expect(err).ToNot(HaveOccurred())
+			if env == nil {
+				return ids
+			}
+
+			ids = append(ids, env.SourceId)
+			q.Ack()
+		}
+	}
+
+	It("replays envelopes in order", func() {
+		store, err := egress.NewSpillStore(dir, 1<<20, 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		q := openQueue(store)
+
+		Expect(q.Empty()).To(BeTrue())
+		Expect(q.Append(&loggregator_v2.Envelope{SourceId: "1"})).To(Succeed())
+		Expect(q.Append(&loggregator_v2.Envelope{SourceId: "2"})).To(Succeed())
+		Expect(q.Empty()).To(BeFalse())
+
+		Expect(readAll(q)).To(Equal([]string{"1", "2"}))
+		Expect(q.Empty()).To(BeTrue())
+	})
+
+	It("does not remove an envelope until it is acked", func() {
+		store, err := egress.NewSpillStore(dir, 1<<20, 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		q := openQueue(store)
+		Expect(q.Append(&loggregator_v2.Envelope{SourceId: "1"})).To(Succeed())
+
+		env, err := q.Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.SourceId).To(Equal("1"))
+
+		env, err = q.Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.SourceId).To(Equal("1"))
+	})
+
+	It("prepends envelopes in front of the queue", func() {
+		store, err := egress.NewSpillStore(dir, 1<<20, 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		q := openQueue(store)
+		Expect(q.Append(&loggregator_v2.Envelope{SourceId: "3"})).To(Succeed())
+
+		missed, err := q.Prepend([]*loggregator_v2.Envelope{{SourceId: "1"}, {SourceId: "2"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(missed).To(BeZero())
+
+		Expect(readAll(q)).To(Equal([]string{"1", "2", "3"}))
+	})
+
+	It("does not replay acked envelopes when prepending after a partial read", func() {
+		store, err := egress.NewSpillStore(dir, 1<<20, 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		q := openQueue(store)
+		for _, id := range []string{"1", "2", "3"} {
+			Expect(q.Append(&loggregator_v2.Envelope{SourceId: id})).To(Succeed())
+		}
+		env, err := q.Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.SourceId).To(Equal("1"))
+		q.Ack()
+
+		_, err = q.Prepend([]*loggregator_v2.Envelope{{SourceId: "0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(q.Close()).To(Succeed())
+
+		store, err = egress.NewSpillStore(dir, 1<<20, 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		q = openQueue(store)
+
+		Expect(readAll(q)).To(Equal([]string{"0", "2", "3"}))
+	})
+
+	It("survives being reopened", func() {
+		store, err := egress.NewSpillStore(dir, 1<<20, 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		q := openQueue(store)
+		for _, id := range []string{"1", "2", "3"} {
+			Expect(q.Append(&loggregator_v2.Envelope{SourceId: id})).To(Succeed())
+		}
+		_, err = q.Next()
+		Expect(err).ToNot(HaveOccurred())
+		q.Ack()
+		Expect(q.Close()).To(Succeed())
+
+		store, err = egress.NewSpillStore(dir, 1<<20, 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		q = openQueue(store)
+		Expect(q.Append(&loggregator_v2.Envelope{SourceId: "4"})).To(Succeed())
+
+		Expect(readAll(q)).To(Equal([]string{"2", "3", "4"}))
+	})
+
+	It("only allows one open queue per binding", func() {
+		store, err := egress.NewSpillStore(dir, 1<<20, 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		q := openQueue(store)
+
+		_, err = store.Open(binding)
+		Expect(err).To(HaveOccurred())
+
+		Expect(q.Close()).To(Succeed())
+		_, err = store.Open(binding)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("enforces the per binding quota", func() {
+		store, err := egress.NewSpillStore(dir, 100, 1<<20)
+		Expect(err).ToNot(HaveOccurred())
+		q := openQueue(store)
+
+		env := &loggregator_v2.Envelope{SourceId: "some-long-source-id-to-fill-the-quota"}
+		Expect(q.Append(env)).To(Succeed())
+		Expect(q.Append(env)).To(Succeed())
+		Expect(q.Append(env)).To(Equal(egress.ErrSpillFull))
+	})
+
+	It("enforces the adapter wide quota", func() {
+		store, err := egress.NewSpillStore(dir, 1<<20, 100)
+		Expect(err).ToNot(HaveOccurred())
+		q := openQueue(store)
+		env := &loggregator_v2.Envelope{SourceId: "some-long-source-id-to-fill-the-quota"}
+		Expect(q.Append(env)).To(Succeed())
+		Expect(q.Append(env)).To(Succeed())
+
+		u, _ := url.Parse("syslog://other-host:123")
+		other, err := store.Open(&egress.URLBinding{AppID: "other-app-id", URL: u})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(other.Append(env)).To(Equal(egress.ErrSpillFull))
+
+		readAll(q)
+		Expect(other.Append(env)).To(Succeed())
+	})
+
+	It("deletes the queues of removed bindings", func() {
+		store, err := egress.NewSpillStore(dir, 1<<20, 100)
+		Expect(err).ToNot(HaveOccurred())
+		q := openQueue(store)
+		env := &loggregator_v2.Envelope{SourceId: "some-long-source-id-to-fill-the-quota"}
+		Expect(q.Append(env)).To(Succeed())
+		Expect(q.Append(env)).To(Succeed())
+
+		connector := egress.NewSyslogConnector(
+			egress.NetworkTimeoutConfig{},
+			true,
+			&SpyWaitGroup{},
+			egress.WithSpillStore(store),
+		)
+		connector.Remove(&v1.Binding{AppId: "some-app-id", Drain: "syslog://some-host:123"})
+		Expect(ioutil.ReadDir(dir)).To(HaveLen(1))
+
+		Expect(q.Close()).To(Succeed())
+		Expect(ioutil.ReadDir(dir)).To(BeEmpty())
+
+		u, _ := url.Parse("syslog://other-host:123")
+		other, err := store.Open(&egress.URLBinding{AppID: "other-app-id", URL: u})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(other.Append(env)).To(Succeed())
+		Expect(other.Append(env)).To(Succeed())
+		Expect(other.Close()).To(Succeed())
+
+		connector.Remove(&v1.Binding{AppId: "other-app-id", Drain: "syslog://other-host:123"})
+		Expect(ioutil.ReadDir(dir)).To(BeEmpty())
+		q = openQueue(store)
+		Expect(q.Append(env)).To(Succeed())
+	})
+})
+
+var _ = Describe("DiodeWriter with a spill queue", func() {
+	var (
+		dir   string
+		queue *egress.SpillQueue
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "spill")
+		Expect(err).ToNot(HaveOccurred())
+
+		store, err := egress.NewSpillStore(dir, 1<<30, 1<<30)
+		Expect(err).ToNot(HaveOccurred())
+
+		u, _ := url.Parse("syslog://some-host:123")
+		queue, err = store.Open(&egress.URLBinding{AppID: "some-app-id", URL: u})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("spills to disk instead of dropping and replays in order", func() {
+		spyWriter := &SpyWriter{blockWrites: true}
+		spyAlerter := &SpyAlerter{}
+		dw := egress.NewDiodeWriter(context.TODO(), spyWriter, spyAlerter, &SpyWaitGroup{}, egress.WithSpillQueue(queue))
+
+		envs := make([]*loggregator_v2.Envelope, 10100)
+		for i := range envs {
+			envs[i] = &loggregator_v2.Envelope{Timestamp: int64(i)}
+			dw.Write(envs[i])
+		}
+		Expect(queue.Empty()).To(BeFalse())
+
+		spyWriter.WriteBlocked(false)
+
+		Eventually(func() int { return len(spyWriter.calledWith()) }, 5).Should(Equal(len(envs)))
+		for i, env := range spyWriter.calledWith() {
+			Expect(env.Timestamp).To(Equal(int64(i)))
+		}
+		Expect(spyAlerter.missed()).To(BeZero())
+	})
+
+	It("alerts when the disk quota is exhausted", func() {
+		store, err := egress.NewSpillStore(dir+"/small", 1, 1)
+		Expect(err).ToNot(HaveOccurred())
+		u, _ := url.Parse("syslog://other-host:123")
+		q, err := store.Open(&egress.URLBinding{AppID: "other-app-id", URL: u})
+		Expect(err).ToNot(HaveOccurred())
+
+		spyWriter := &SpyWriter{blockWrites: true}
+		spyAlerter := &SpyAlerter{}
+		dw := egress.NewDiodeWriter(context.TODO(), spyWriter, spyAlerter, &SpyWaitGroup{}, egress.WithSpillQueue(q))
+
+		for i := 0; i < 10005; i++ {
+			dw.Write(&loggregator_v2.Envelope{})
+		}
+
+		Eventually(spyAlerter.missed).Should(BeNumerically(">=", 4))
+	})
+
+	It("saves envelopes left in memory when it cannot write them on shutdown", func() {
+		spyWriter := &SpyWriter{blockWrites: true}
+		ctx, cancel := context.WithCancel(context.TODO())
+		dw := egress.NewDiodeWriter(ctx, spyWriter, &SpyAlerter{}, &SpyWaitGroup{}, egress.WithSpillQueue(queue))
+
+		for i := 0; i < 3; i++ {
+			dw.Write(&loggregator_v2.Envelope{Timestamp: int64(i)})
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		spyWriter.mu.Lock()
+		spyWriter.writeError = context.Canceled
+		spyWriter.mu.Unlock()
+		cancel()
+		spyWriter.WriteBlocked(false)
+
+		Eventually(spyWriter.CloseCalled).Should(Equal(int64(1)))
+		Expect(queue.Empty()).To(BeFalse())
+	})
+})
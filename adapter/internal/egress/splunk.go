@@ -0,0 +1,314 @@
+package egress
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+const (
+	splunkEventPath = "/services/collector/event"
+	splunkAckPath   = "/services/collector/ack"
+
+	// splunkAckTimeout is how long Splunk has to acknowledge a batch before
+	// it is reported as dropped, unless the drain URL sets ack-timeout.
+	splunkAckTimeout  = 30 * time.Second
+	splunkAckInterval = 500 * time.Millisecond
+)
+
+// hecSettings holds the event metadata configured on a Splunk drain URL.
+type hecSettings struct {
+	index      string
+	source     string
+	sourceType string
+}
+
+// hecEvent is an event as accepted by the Splunk HTTP Event Collector.
+type hecEvent struct {
+	Time       float64           `json:"time"`
+	Host       string            `json:"host,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	SourceType string            `json:"sourcetype,omitempty"`
+	Index      string            `json:"index,omitempty"`
+	Event      jsonRecord        `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// SplunkWriterConstructor returns a WriterConstructor for splunk and
+// splunk-hec drains. Events are batched and posted to the HTTP Event
+// Collector of the drain host. The drain URL sets the token and optionally
+// the index, source and sourcetype of the events, for example:
+//
+//	splunk://splunk.example.com:8088?token=<token>&index=main&sourcetype=cf
+//
+// With ack=true the acknowledgement of every batch is tracked in the
+// background. Batches that are not acknowledged within ack-timeout, 30s by
+// default, are reported as dropped. The HTTPS options apply as they do for HTTPS drains.
+func SplunkWriterConstructor(opts ...HTTPSOption) WriterConstructor {
+	return WriterConstructor(func(
+		binding *URLBinding,
+		netConf NetworkTimeoutConfig,
+		skipCertVerify bool,
+		egressMetric pulseemitter.CounterMetric,
+	) WriteCloser {
+		opts := append(opts[:len(opts):len(opts)], withSplunk(binding))
+
+		return newHTTPSWriter(binding, netConf, skipCertVerify, egressMetric, opts)
+	})
+}
+
+// withSplunk configures an HTTPSWriter to talk to the HTTP Event Collector.
+// Unlike HTTPS drains, Splunk drains batch by default.
+func withSplunk(binding *URLBinding) HTTPSOption {
+	return func(w *HTTPSWriter) {
+		q := binding.URL.Query()
+
+		path := binding.URL.Path
+		if path == "" || path == "/" {
+			path = splunkEventPath
+		}
+		endpoint := url.URL{Scheme: "https", Host: binding.URL.Host, Path: path}
+		channel := newChannelID()
+
+		w.format = hecFormat
+		w.endpoint = endpoint.String()
+		w.header = http.Header{
+			"Authorization":            {"Splunk " + q.Get("token")},
+			"X-Splunk-Request-Channel": {channel},
+		}
+		w.hec = &hecSettings{
+			index:      q.Get("index"),
+			source:     q.Get("source"),
+			sourceType: q.Get("sourcetype"),
+		}
+		if w.batchSize <= 0 && w.batchDelay <= 0 {
+			w.batchSize = defaultHTTPSBatchSize
+			w.batchDelay = defaultHTTPSBatchDelay
+		}
+
+		endpoint.Path = splunkAckPath
+		endpoint.RawQuery = url.Values{"channel": {channel}}.Encode()
+		timeout, err := time.ParseDuration(q.Get("ack-timeout"))
+		if err != nil || timeout <= 0 {
+			timeout = splunkAckTimeout
+		}
+		acker := &hecAcker{
+			ctx:     binding.ctx(),
+			binding: binding,
+			ackURL:  endpoint.String(),
+			enabled: q.Get("ack") == "true",
+			timeout: timeout,
+			pending: make(map[int64]pendingAck),
+		}
+		w.checkResponse = acker.check
+	}
+}
+
+// generateHECMessages converts an envelope into HEC events. The events carry
+// the same JSON records as the json format.
+func generateHECMessages(
+	env *loggregator_v2.Envelope,
+	hostname string,
+	appID string,
+	tags *tagFilter,
+	s *hecSettings,
+) ([][]byte, error) {
+	records := generateJSONRecords(env, hostname, appID, tags)
+
+	msgs := make([][]byte, 0, len(records))
+	for _, r := range records {
+		b, err := json.Marshal(hecEvent{
+			Time:       float64(env.GetTimestamp()) / float64(time.Second),
+			Host:       hostname,
+			Source:     s.source,
+			SourceType: s.sourceType,
+			Index:      s.index,
+			Event:      r,
+			Fields:     map[string]string{"app_id": appID},
+		})
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, b)
+	}
+
+	return msgs, nil
+}
+
+// hecAcker checks HEC responses and, when indexer acknowledgement is
+// enabled, tracks the acknowledgement of the posted batches. The ack
+// endpoint is polled outside of the writer lock so that writes are not held
+// up while Splunk indexes a batch.
+type hecAcker struct {
+	ctx     context.Context
+	binding *URLBinding
+	ackURL  string
+	enabled bool
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[int64]pendingAck
+	polling bool
+}
+
+// pendingAck is a batch that was accepted by the collector but not yet
+// acknowledged.
+type pendingAck struct {
+	count  int
+	sentAt time.Time
+}
+
+type hecResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+func (a *hecAcker) check(w *HTTPSWriter, body []byte, count int) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	var resp hecResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("Splunk Writer: invalid response: %s", err)
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("Splunk Writer: HEC responded with code %d: %s", resp.Code, resp.Text)
+	}
+
+	if !a.enabled || resp.AckID == nil {
+		return nil
+	}
+
+	a.track(w, *resp.AckID, count)
+
+	return nil
+}
+
+// track records a batch that awaits acknowledgement and starts polling the
+// ack endpoint if it is not polled yet.
+func (a *hecAcker) track(w *HTTPSWriter, id int64, count int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending[id] = pendingAck{count: count, sentAt: time.Now()}
+	if !a.polling {
+		a.polling = true
+		go a.poll(w)
+	}
+}
+
+// poll resolves the pending acknowledgements until none are left or the
+// binding is removed. Batches that are not acknowledged within the timeout
+// are reported as dropped instead of being sent again,
+// since Splunk may still index them.
+func (a *hecAcker) poll(w *HTTPSWriter) {
+	for {
+		if !sleep(a.ctx, splunkAckInterval) {
+			return
+		}
+
+		a.mu.Lock()
+		ids := make([]int64, 0, len(a.pending))
+		for id := range a.pending {
+			ids = append(ids, id)
+		}
+		a.mu.Unlock()
+
+		acks, err := a.acked(w, ids)
+		if err != nil {
+			log.Printf("failed to poll Splunk acknowledgements for %s: %s", a.binding.URL.Host, err)
+		}
+
+		var lost int
+		a.mu.Lock()
+		for _, id := range ids {
+			p := a.pending[id]
+			if acks[strconv.FormatInt(id, 10)] {
+				delete(a.pending, id)
+				continue
+			}
+			if time.Since(p.sentAt) >= a.timeout {
+				delete(a.pending, id)
+				lost += p.count
+			}
+		}
+		done := len(a.pending) == 0
+		if done {
+			a.polling = false
+		}
+		a.mu.Unlock()
+
+		if lost > 0 {
+			log.Printf("%d messages were not acknowledged by Splunk drain %s within %s", lost, a.binding.URL.Host, a.timeout)
+			a.binding.reportDropped(lost)
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// acked asks the collector which of the batches have been indexed.
+func (a *hecAcker) acked(w *HTTPSWriter, ids []int64) (map[string]bool, error) {
+	body, err := json.Marshal(map[string][]int64{"acks": ids})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.ackURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range w.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Splunk Writer: ack responded with %d status code", resp.StatusCode)
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var acks struct {
+		Acks map[string]bool `json:"acks"`
+	}
+	if err := json.Unmarshal(respBody, &acks); err != nil {
+		return nil, fmt.Errorf("Splunk Writer: invalid ack response: %s", err)
+	}
+
+	return acks.Acks, nil
+}
+
+// newChannelID returns a random UUID used to identify the writer to Splunk.
+func newChannelID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
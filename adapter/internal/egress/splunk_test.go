@@ -0,0 +1,223 @@
+package egress_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
+	"code.cloudfoundry.org/scalable-syslog/internal/testhelper"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SplunkWriter", func() {
+	var (
+		hec     *spyHEC
+		netConf = egress.NetworkTimeoutConfig{}
+	)
+
+	BeforeEach(func() {
+		hec = newSpyHEC()
+	})
+
+	AfterEach(func() {
+		hec.Close()
+	})
+
+	newWriter := func(query string) egress.WriteCloser {
+		u := strings.Replace(hec.URL, "https://", "splunk://", 1) + "?token=some-token&" + query
+		b := buildURLBinding(u, "test-app-id", "test-hostname")
+
+		return egress.SplunkWriterConstructor()(b, netConf, true, &testhelper.SpyMetric{})
+	}
+
+	It("posts batched events to the event collector", func() {
+		writer := newWriter("index=main&source=cf&sourcetype=cf:log")
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+
+		reqs := hec.requests()
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].path).To(Equal("/services/collector/event"))
+		Expect(reqs[0].header.Get("Authorization")).To(Equal("Splunk some-token"))
+		Expect(reqs[0].header.Get("X-Splunk-Request-Channel")).ToNot(BeEmpty())
+		Expect(reqs[0].header.Get("Content-Type")).To(Equal("application/json"))
+
+		events := bytes.Split(bytes.TrimSpace(reqs[0].body), []byte("\n"))
+		Expect(events).To(HaveLen(2))
+		Expect(events[0]).To(MatchJSON(`{
+			"time": 0.012345678,
+			"host": "test-hostname",
+			"source": "cf",
+			"sourcetype": "cf:log",
+			"index": "main",
+			"fields": {"app_id": "test-app-id"},
+			"event": {
+				"timestamp": "1970-01-01T00:00:00.012345678Z",
+				"app_id": "test-app-id",
+				"hostname": "test-hostname",
+				"process_id": "[APP/1]",
+				"instance": "1",
+				"log_type": "OUT",
+				"message": "just a test",
+				"tags": {"source_type": "APP"}
+			}
+		}`))
+	})
+
+	It("returns an error when the collector is busy", func() {
+		hec.status = http.StatusServiceUnavailable
+		writer := newWriter("batch-size=1")
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(MatchError(ContainSubstring("503")))
+	})
+
+	It("returns an error when the collector reports an error code", func() {
+		hec.response = `{"text":"Invalid token","code":4}`
+		writer := newWriter("batch-size=1")
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(MatchError(ContainSubstring("Invalid token")))
+	})
+
+	It("polls for the acknowledgement of batches in the background", func() {
+		hec.response = `{"text":"Success","code":0,"ackId":7}`
+		hec.pendingAcks = 1
+		writer := newWriter("batch-size=1&ack=true")
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(hec.requests()).To(HaveLen(1))
+
+		Eventually(hec.requests, 5).Should(HaveLen(3))
+		reqs := hec.requests()
+		Expect(reqs[1].path).To(Equal("/services/collector/ack"))
+		Expect(reqs[1].query).To(Equal("channel=" + reqs[0].header.Get("X-Splunk-Request-Channel")))
+		Expect(reqs[1].body).To(MatchJSON(`{"acks":[7]}`))
+		Expect(reqs[2].path).To(Equal("/services/collector/ack"))
+		Consistently(hec.requests).Should(HaveLen(3))
+	})
+
+	Context("when batches are not acknowledged in time", func() {
+		var (
+			droppedMetric *testhelper.SpyMetric
+			logClient     *spyLogClient
+			cancel        context.CancelFunc
+		)
+
+		BeforeEach(func() {
+			hec.response = `{"text":"Success","code":0,"ackId":7}`
+			hec.pendingAcks = 100
+			droppedMetric = &testhelper.SpyMetric{}
+			logClient = newSpyLogClient()
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		connect := func(query string) egress.Writer {
+			connector := egress.NewSyslogConnector(
+				netConf,
+				true,
+				&SpyWaitGroup{},
+				egress.WithConstructors(map[string]egress.WriterConstructor{
+					"splunk": egress.SplunkWriterConstructor(),
+				}),
+				egress.WithEgressMetrics(map[string]pulseemitter.CounterMetric{
+					"splunk": &testhelper.SpyMetric{},
+				}),
+				egress.WithDroppedMetrics(map[string]pulseemitter.CounterMetric{
+					"splunk": droppedMetric,
+				}),
+				egress.WithLogClient(logClient, "3"),
+			)
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			writer, err := connector.Connect(ctx, &v1.Binding{
+				AppId: "app-id",
+				Drain: strings.Replace(hec.URL, "https://", "splunk://", 1) + "?token=some-token&ack=true&ack-timeout=1s&" + query,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			return writer
+		}
+
+		eventPosts := func() int {
+			posts := 0
+			for _, r := range hec.requests() {
+				if r.path == "/services/collector/event" {
+					posts++
+				}
+			}
+			return posts
+		}
+
+		It("reports them as dropped", func() {
+			writer := connect("batch-size=1")
+
+			env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+
+			Eventually(droppedMetric.Delta, 5).Should(Equal(uint64(1)))
+			Expect(logClient.message()).To(ContainElement("1 messages lost in user provided syslog drain"))
+			Expect(eventPosts()).To(Equal(1))
+		})
+
+		It("reports every event of an envelope posted without batching", func() {
+			writer := connect("batch-size=0&batch-delay=0")
+
+			Expect(writer.Write(buildGaugeEnvelope("1"))).To(Succeed())
+
+			Eventually(droppedMetric.Delta, 5).Should(Equal(uint64(5)))
+			Expect(logClient.message()).To(ContainElement("5 messages lost in user provided syslog drain"))
+			Expect(eventPosts()).To(Equal(1))
+		})
+	})
+})
+
+type spyHEC struct {
+	*spyHTTPServer
+
+	status      int
+	response    string
+	pendingAcks int
+}
+
+func newSpyHEC() *spyHEC {
+	h := &spyHEC{
+		status:   http.StatusOK,
+		response: `{"text":"Success","code":0}`,
+	}
+	h.spyHTTPServer = newSpyHTTPServer(func(w http.ResponseWriter, r spyHTTPRequest) {
+		if r.path == "/services/collector/ack" {
+			var req struct {
+				Acks []int `json:"acks"`
+			}
+			Expect(json.Unmarshal(r.body, &req)).To(Succeed())
+
+			acked := h.pendingAcks == 0
+			h.pendingAcks--
+			json.NewEncoder(w).Encode(map[string]map[string]bool{
+				"acks": {"7": acked},
+			})
+			return
+		}
+
+		w.WriteHeader(h.status)
+		w.Write([]byte(h.response))
+	})
+
+	return h
+}
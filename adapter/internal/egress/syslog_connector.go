@@ -51,6 +51,13 @@ type SyslogConnector struct {
 	logClient      LogClient
 	wg             WaitGroup
 	sourceIndex    string
+	spillStore     *SpillStore
+	redaction      []RedactionRule
+	redactedMetric pulseemitter.CounterMetric
+
+	connectionMetrics []pulseemitter.CounterMetric
+	connPool          *connectionPool
+	proxy             *Proxy
 }
 
 // NewSyslogConnector configures and returns a new SyslogConnector.
@@ -77,8 +84,8 @@ func NewSyslogConnector(
 	return sc
 }
 
-// WriterConstructor creates syslog connections to https, syslog, and
-// syslog-tls drains
+// WriterConstructor creates syslog connections to https, syslog, syslog-tls,
+// and syslog-udp drains
 type WriterConstructor func(
 	binding *URLBinding,
 	netConf NetworkTimeoutConfig,
@@ -123,8 +130,58 @@ func WithLogClient(logClient LogClient, sourceIndex string) ConnectorOption {
 	}
 }
 
+// WithSpillStore returns a ConnectorOption that makes every binding spill
+// envelopes that do not fit into memory to disk.
+func WithSpillStore(s *SpillStore) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		sc.spillStore = s
+	}
+}
+
+// WithRedaction returns a ConnectorOption that redacts log payloads with the
+// given rules. The metric counts the redacted matches.
+func WithRedaction(rules []RedactionRule, metric pulseemitter.CounterMetric) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		sc.redaction = rules
+		sc.redactedMetric = metric
+	}
+}
+
+// WithConnectionMetrics returns a ConnectorOption that counts the envelopes
+// written by each of the parallel connections of a binding. metrics[i]
+// counts connection i of every binding, so the metrics are adapter wide.
+// Bindings with a single connection are not counted.
+func WithConnectionMetrics(metrics []pulseemitter.CounterMetric) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		sc.connectionMetrics = metrics
+	}
+}
+
+// WithSharedConnections returns a ConnectorOption that lets syslog and
+// syslog-tls bindings with the same destination and settings share up to
+// size connections instead of opening one each. Bindings that ask for
+// parallel connections do not share.
+func WithSharedConnections(size int) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		if size > 0 {
+			sc.connPool = newConnectionPool(size)
+		}
+	}
+}
+
+// WithProxy returns a ConnectorOption that connects to drains through the
+// proxy. A nil proxy connects directly.
+func WithProxy(p *Proxy) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		sc.proxy = p
+	}
+}
+
 // Connect returns an egress writer based on the scheme of the binding drain
-// URL.
+// URL. syslog and syslog-tls drains with the connections query parameter get
+// one writer per connection, each with its own circuit breaker, diode and
+// spill queue. Log payloads are redacted before they are
+// buffered in memory or spilled to disk.
 func (w *SyslogConnector) Connect(ctx context.Context, b *v1.Binding) (Writer, error) {
 	urlBinding, err := buildBinding(ctx, b)
 	if err != nil {
@@ -135,12 +192,64 @@ func (w *SyslogConnector) Connect(ctx context.Context, b *v1.Binding) (Writer, e
 		return nil, err
 	}
 
-	droppedMetric := w.droppedMetrics[urlBinding.Scheme()]
-	egressMetric := w.egressMetrics[urlBinding.Scheme()]
 	constructor, ok := w.constructors[urlBinding.Scheme()]
 	if !ok {
 		return nil, errors.New("unsupported protocol")
 	}
+	urlBinding.proxy = w.proxy
+	urlBinding.dropped = w.dropReporter(b.AppId, urlBinding.Scheme())
+
+	var writer Writer
+	n := connectionsFromURL(urlBinding)
+	if n == 1 {
+		urlBinding.connPool = w.connPool
+		writer = w.connectWriter(ctx, urlBinding, constructor, 0, nil)
+	} else {
+		writers := make([]Writer, 0, n)
+		for i := 0; i < n; i++ {
+			var connMetric pulseemitter.CounterMetric
+			if i < len(w.connectionMetrics) {
+				connMetric = w.connectionMetrics[i]
+			}
+			writers = append(writers, w.connectWriter(ctx, urlBinding, constructor, i, connMetric))
+		}
+		writer = newShardedWriter(writers)
+	}
+
+	return newRedactingWriter(
+		writer,
+		redactionRulesFromURL(w.redaction, urlBinding.URL),
+		w.redactedMetric,
+	), nil
+}
+
+// Remove deletes the envelopes spilled to disk for a binding that was
+// removed from the adapter. Spill queues still in use are deleted once their
+// writers are done.
+func (w *SyslogConnector) Remove(b *v1.Binding) {
+	if w.spillStore == nil {
+		return
+	}
+
+	urlBinding, err := buildBinding(context.Background(), b)
+	if err != nil {
+		return
+	}
+
+	w.spillStore.remove(urlBinding, connectionsFromURL(urlBinding))
+}
+
+// connectWriter creates connection i of the binding and returns the diode
+// writer that feeds it. connMetric, if set, counts the envelopes written by
+// the connection.
+func (w *SyslogConnector) connectWriter(
+	ctx context.Context,
+	urlBinding *URLBinding,
+	constructor WriterConstructor,
+	i int,
+	connMetric pulseemitter.CounterMetric,
+) Writer {
+	egressMetric := w.egressMetrics[urlBinding.Scheme()]
 	netConf := NetworkTimeoutConfig{
 		Keepalive:    w.keepalive,
 		DialTimeout:  w.dialTimeout,
@@ -152,18 +261,37 @@ func (w *SyslogConnector) Connect(ctx context.Context, b *v1.Binding) (Writer, e
 		w.skipCertVerify,
 		egressMetric,
 	)
+	if connMetric != nil {
+		writer = &connectionMetricWriter{WriteCloser: writer, metric: connMetric}
+	}
+
+	var opts []DiodeWriterOption
+	if w.spillStore != nil {
+		q, err := w.spillStore.openConnection(ctx, urlBinding, i)
+		if err != nil {
+			log.Printf("spilling to disk disabled for %s: %s", urlBinding.URL.Host, err)
+		} else {
+			opts = append(opts, WithSpillQueue(q))
+		}
+	}
 
-	dw := NewDiodeWriter(ctx, writer, diodes.AlertFunc(func(missed int) {
+	return NewDiodeWriter(ctx, writer, diodes.AlertFunc(urlBinding.reportDropped), w.wg, opts...)
+}
+
+// dropReporter returns a function that counts lost envelopes in the dropped
+// metric of the scheme and tells the app about them.
+func (w *SyslogConnector) dropReporter(appID, scheme string) func(missed int) {
+	droppedMetric := w.droppedMetrics[scheme]
+
+	return func(missed int) {
 		if droppedMetric != nil {
 			droppedMetric.Increment(uint64(missed))
 		}
 
-		w.emitErrorLog(b.AppId, fmt.Sprintf("%d messages lost in user provided syslog drain", missed))
+		w.emitErrorLog(appID, fmt.Sprintf("%d messages lost in user provided syslog drain", missed))
 
-		log.Printf("Dropped %d %s logs", missed, urlBinding.Scheme())
-	}), w.wg)
-
-	return dw, nil
+		log.Printf("Dropped %d %s logs", missed, scheme)
+	}
 }
 
 func (w *SyslogConnector) emitErrorLog(appID, message string) {
@@ -2,6 +2,10 @@ package egress_test
 
 import (
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"golang.org/x/net/context"
@@ -288,6 +292,154 @@ var _ = Describe("SyslogConnector", func() {
 			Expect(f).ToNot(Panic())
 		})
 	})
+
+	It("keeps spilling to disk after a binding reconnects", func() {
+		dir, err := ioutil.TempDir("", "spill")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		store, err := egress.NewSpillStore(dir, 1<<30, 1<<30)
+		Expect(err).ToNot(HaveOccurred())
+
+		written := make(chan *loggregator_v2.Envelope)
+		connector := egress.NewSyslogConnector(
+			netConf,
+			true,
+			spyWaitGroup,
+			egress.WithConstructors(map[string]egress.WriterConstructor{
+				"syslog": func(*egress.URLBinding, egress.NetworkTimeoutConfig, bool, pulseemitter.CounterMetric) egress.WriteCloser {
+					return &channelWriteCloser{written: written}
+				},
+			}),
+			egress.WithSpillStore(store),
+		)
+		binding := &v1.Binding{AppId: "some-app-id", Drain: "syslog://some-host"}
+
+		firstCtx, cancel := context.WithCancel(context.Background())
+		w, err := connector.Connect(firstCtx, binding)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Write(buildLogEnvelope("APP", "1", "before reconnect", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(written).Should(Receive())
+		cancel()
+
+		secondCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		w, err = connector.Connect(secondCtx, binding)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 10100; i++ {
+			env := buildLogEnvelope("APP", "1", "after reconnect", loggregator_v2.Log_OUT)
+			Expect(w.Write(env)).To(Succeed())
+		}
+
+		var spilled []byte
+		err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			b, err := ioutil.ReadFile(path)
+			spilled = append(spilled, b...)
+			return err
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(spilled)).To(ContainSubstring("after reconnect"))
+	})
+
+	Context("with parallel connections", func() {
+		var (
+			conns   []chan *loggregator_v2.Envelope
+			metrics []*testhelper.SpyMetric
+		)
+
+		connect := func(drain string) egress.Writer {
+			conns = nil
+			metrics = nil
+			constructor := func(
+				*egress.URLBinding,
+				egress.NetworkTimeoutConfig,
+				bool,
+				pulseemitter.CounterMetric,
+			) egress.WriteCloser {
+				c := make(chan *loggregator_v2.Envelope, 100)
+				conns = append(conns, c)
+				return &channelWriteCloser{written: c}
+			}
+
+			var connMetrics []pulseemitter.CounterMetric
+			for i := 0; i < egress.MaxConnections; i++ {
+				m := &testhelper.SpyMetric{}
+				metrics = append(metrics, m)
+				connMetrics = append(connMetrics, m)
+			}
+
+			connector := egress.NewSyslogConnector(
+				netConf,
+				true,
+				spyWaitGroup,
+				egress.WithConstructors(map[string]egress.WriterConstructor{
+					"syslog": constructor,
+					"https":  constructor,
+				}),
+				egress.WithConnectionMetrics(connMetrics),
+			)
+
+			writer, err := connector.Connect(ctx, &v1.Binding{Drain: drain})
+			Expect(err).ToNot(HaveOccurred())
+
+			return writer
+		}
+
+		It("shards envelopes by source instance", func() {
+			writer := connect("syslog://example.com?connections=4")
+			Expect(conns).To(HaveLen(4))
+
+			for i := 0; i < 40; i++ {
+				writer.Write(&loggregator_v2.Envelope{
+					SourceId:   "test-source-id",
+					InstanceId: strconv.Itoa(i % 8),
+					Timestamp:  int64(i),
+				})
+			}
+
+			received := make(map[string][]int)
+			total := 0
+			Eventually(func() int {
+				for i, c := range conns {
+					for len(c) > 0 {
+						env := <-c
+						received[env.InstanceId] = append(received[env.InstanceId], i)
+						total++
+					}
+				}
+				return total
+			}).Should(Equal(40))
+
+			used := make(map[int]bool)
+			for _, connsOfInstance := range received {
+				for _, c := range connsOfInstance {
+					Expect(c).To(Equal(connsOfInstance[0]))
+				}
+				used[connsOfInstance[0]] = true
+			}
+			Expect(len(used)).To(BeNumerically(">", 1))
+
+			Eventually(func() uint64 {
+				var written uint64
+				for i := range conns {
+					written += metrics[i].Delta()
+				}
+				return written
+			}).Should(Equal(uint64(40)))
+		})
+
+		It("limits the number of connections", func() {
+			connect("syslog://example.com?connections=100")
+			Expect(conns).To(HaveLen(egress.MaxConnections))
+		})
+
+		It("uses a single connection for other schemes", func() {
+			connect("https://example.com?connections=4")
+			Expect(conns).To(HaveLen(1))
+		})
+	})
 })
 
 type incrementor interface {
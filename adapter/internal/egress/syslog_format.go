@@ -0,0 +1,205 @@
+package egress
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// rfc3164Format writes messages in the BSD syslog format of RFC 3164. It can
+// be selected with the format query parameter of syslog and HTTPS drains.
+const rfc3164Format = "rfc3164"
+
+const (
+	// maxRFC3164TagLength is the longest TAG allowed by RFC 3164.
+	maxRFC3164TagLength = 32
+
+	// maxRFC3164HostnameLength is the longest hostname written. RFC 3164
+	// does not limit it, so the limit of DNS names is used.
+	maxRFC3164HostnameLength = 255
+
+	rfc3164TimeFormat = "Jan _2 15:04:05"
+)
+
+// syslogFormatter converts an envelope into marshaled syslog messages.
+type syslogFormatter interface {
+	format(env *loggregator_v2.Envelope) ([][]byte, error)
+}
+
+// syslogFormatterFromURL returns the formatter selected by the format query
+// parameter of the drain URL. Unknown values fall back to RFC 5424. The
+// scheduler rejects drains with unknown values before they reach the
+// adapter.
+func syslogFormatterFromURL(binding *URLBinding) syslogFormatter {
+	tags := tagsFromURL(binding.URL)
+
+	if binding.URL.Query().Get("format") == rfc3164Format {
+		return &rfc3164Formatter{
+			hostname: binding.Hostname,
+			appID:    binding.AppID,
+			tags:     tags,
+			location: rfc3164Location(binding.URL),
+		}
+	}
+
+	return &rfc5424Formatter{
+		hostname: binding.Hostname,
+		appID:    binding.AppID,
+		tags:     tags,
+	}
+}
+
+// rfc5424Formatter writes messages as described by RFC 5424.
+type rfc5424Formatter struct {
+	hostname string
+	appID    string
+	tags     *tagFilter
+}
+
+func (f *rfc5424Formatter) format(env *loggregator_v2.Envelope) ([][]byte, error) {
+	msgs := generateRFC5424Messages(env, f.hostname, f.appID, f.tags)
+
+	encoded := make([][]byte, 0, len(msgs))
+	for _, msg := range msgs {
+		b, err := msg.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, b)
+	}
+
+	return encoded, nil
+}
+
+// rfc3164Formatter writes messages as
+//
+//	<PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+//
+// The TAG is the app ID, or the app name if the ID does not fit, and the PID
+// the process ID of the RFC 5424 message.
+// Structured data, which RFC 3164 has no place for, is written in front of
+// the message.
+type rfc3164Formatter struct {
+	hostname string
+	appID    string
+	tags     *tagFilter
+	location *time.Location
+}
+
+func (f *rfc3164Formatter) format(env *loggregator_v2.Envelope) ([][]byte, error) {
+	msgs := generateRFC5424Messages(env, f.hostname, f.appID, f.tags)
+
+	hostname := rfc3164Hostname(f.hostname)
+	tag := rfc3164Tag(f.appID, f.hostname)
+
+	encoded := make([][]byte, 0, len(msgs))
+	for _, msg := range msgs {
+		b := bytes.NewBuffer(make([]byte, 0, len(msg.Message)+64))
+		b.WriteByte('<')
+		b.WriteString(strconv.Itoa(int(msg.Priority)))
+		b.WriteByte('>')
+		b.WriteString(msg.Timestamp.In(f.location).Format(rfc3164TimeFormat))
+		b.WriteByte(' ')
+		b.WriteString(hostname)
+		b.WriteByte(' ')
+		b.WriteString(tag)
+		b.WriteString(msg.ProcessID)
+		b.WriteString(": ")
+		for _, sd := range msg.StructuredData {
+			writeStructuredData(b, sd)
+		}
+		if len(msg.StructuredData) > 0 && !bytes.Equal(msg.Message, []byte("\n")) {
+			b.WriteByte(' ')
+		}
+		b.Write(msg.Message)
+
+		encoded = append(encoded, b.Bytes())
+	}
+
+	return encoded, nil
+}
+
+// rfc3164Location reads the timezone query parameter of the drain URL. RFC
+// 3164 timestamps carry no timezone, so collectors expecting local time can
+// set it to an IANA timezone name. The default and fallback is UTC.
+func rfc3164Location(u *url.URL) *time.Location {
+	name := u.Query().Get("timezone")
+	if name == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// rfc3164Hostname replaces characters that would end the HOSTNAME field and
+// truncates it to maxRFC3164HostnameLength.
+func rfc3164Hostname(h string) string {
+	h = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '-'
+		}
+		return r
+	}, h)
+	if h == "" {
+		return "-"
+	}
+	if len(h) > maxRFC3164HostnameLength {
+		h = h[:maxRFC3164HostnameLength]
+	}
+
+	return h
+}
+
+// rfc3164Tag returns the TAG of an app. App IDs longer than
+// maxRFC3164TagLength, such as GUIDs, are replaced by the app name, which
+// is the last label of the org.space.app hostname, rather than cut short.
+// Characters other than alphanumerics, hyphens, underscores and dots are
+// replaced and a name that still does not fit is truncated.
+func rfc3164Tag(appID, hostname string) string {
+	t := appID
+	if len(t) > maxRFC3164TagLength && hostname != "" {
+		t = hostname[strings.LastIndex(hostname, ".")+1:]
+	}
+
+	t = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, t)
+	if len(t) > maxRFC3164TagLength {
+		t = t[:maxRFC3164TagLength]
+	}
+
+	return t
+}
+
+// writeStructuredData writes an element the way RFC 5424 does.
+func writeStructuredData(b *bytes.Buffer, sd rfc5424.StructuredData) {
+	b.WriteByte('[')
+	b.WriteString(sd.ID)
+	for _, p := range sd.Parameters {
+		b.WriteByte(' ')
+		b.WriteString(p.Name)
+		b.WriteString(`="`)
+		b.WriteString(sdEscaper.Replace(p.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte(']')
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
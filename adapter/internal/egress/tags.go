@@ -0,0 +1,136 @@
+package egress
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// tagsStructuredDataID is the SD-ID of the element that carries envelope
+// tags.
+const tagsStructuredDataID = "tags@47450"
+
+// maxSDNameLength is the longest SD-NAME allowed by RFC 5424.
+const maxSDNameLength = 32
+
+// tagFilter selects the envelope tags written as structured data. A nil
+// filter writes no tags.
+type tagFilter struct {
+	all   bool
+	names map[string]bool
+}
+
+// tagsFromURL reads the include-tags query parameter from a drain URL. The
+// value true includes every tag, any other value is a comma separated list
+// of tag names to include.
+func tagsFromURL(u *url.URL) *tagFilter {
+	v := u.Query().Get("include-tags")
+	switch v {
+	case "", "false":
+		return nil
+	case "true":
+		return &tagFilter{all: true}
+	}
+
+	names := make(map[string]bool)
+	for _, n := range strings.Split(v, ",") {
+		n = strings.TrimSpace(n)
+		if n != "" {
+			names[n] = true
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	return &tagFilter{names: names}
+}
+
+// selected returns the tags selected by the filter or nil if there are
+// none.
+func (f *tagFilter) selected(tags map[string]string) map[string]string {
+	if f == nil || len(tags) == 0 {
+		return nil
+	}
+
+	selected := make(map[string]string, len(tags))
+	for n, v := range tags {
+		if f.all || f.names[n] {
+			selected[n] = v
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	return selected
+}
+
+// structuredData returns the tags selected by the filter as a tags@47450 SD
+// element. Tags are sorted by name so that the output is stable. It returns
+// nil when no tags are selected.
+func (f *tagFilter) structuredData(tags map[string]string) []rfc5424.StructuredData {
+	selected := f.selected(tags)
+	if selected == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(selected))
+	for n := range selected {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	params := make([]rfc5424.SDParam, 0, len(names))
+	for _, n := range names {
+		params = append(params, rfc5424.SDParam{
+			Name:  sdName(n),
+			Value: validUTF8(selected[n]),
+		})
+	}
+
+	return []rfc5424.StructuredData{
+		{
+			ID:         tagsStructuredDataID,
+			Parameters: params,
+		},
+	}
+}
+
+// sdName turns a tag name into a valid SD-NAME by replacing the characters
+// RFC 5424 does not allow with underscores and truncating it to 32
+// characters.
+func sdName(n string) string {
+	b := make([]byte, 0, len(n))
+	for i := 0; i < len(n) && len(b) < maxSDNameLength; i++ {
+		c := n[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+
+	return string(b)
+}
+
+// validUTF8 replaces invalid UTF-8 sequences so the value can be written as a
+// PARAM-VALUE. Escaping of '"', '\' and ']' is done when the message is
+// marshaled.
+func validUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+
+	b := make([]rune, 0, len(s))
+	for _, r := range s {
+		b = append(b, r)
+	}
+
+	return string(b)
+}
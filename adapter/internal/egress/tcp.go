@@ -2,6 +2,7 @@ package egress
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -21,6 +22,8 @@ import (
 const (
 	gaugeStructuredDataID   = "gauge@47450"
 	counterStructuredDataID = "counter@47450"
+	timerStructuredDataID   = "timer@47450"
+	eventStructuredDataID   = "event@47450"
 )
 
 // DialFunc represents a method for creating a connection, either TCP or TLS.
@@ -36,12 +39,17 @@ type TCPWriter struct {
 	dialFunc     DialFunc
 	writeTimeout time.Duration
 	scheme       string
+	framing      framing
+	formatter    syslogFormatter
 	conn         net.Conn
+	shared       *sharedConn
 
 	egressMetric pulseemitter.CounterMetric
 }
 
-// NewTCPWriter creates a new TCP syslog writer.
+// NewTCPWriter creates a new TCP syslog writer. Messages are framed with
+// octet counting unless the drain URL sets framing=lf or framing=nul, and
+// written as RFC 5424 unless it sets format=rfc3164.
 func NewTCPWriter(
 	binding *URLBinding,
 	netConf NetworkTimeoutConfig,
@@ -52,8 +60,9 @@ func NewTCPWriter(
 		Timeout:   netConf.DialTimeout,
 		KeepAlive: netConf.Keepalive,
 	}
+	dial := binding.proxy.dialContext(dialer, false)
 	df := func(addr string) (net.Conn, error) {
-		return dialer.Dial("tcp", addr)
+		return dial(context.Background(), "tcp", addr)
 	}
 
 	w := &TCPWriter{
@@ -63,8 +72,11 @@ func NewTCPWriter(
 		writeTimeout: netConf.WriteTimeout,
 		dialFunc:     df,
 		scheme:       "syslog",
+		framing:      framingFromURL(binding.URL),
+		formatter:    syslogFormatterFromURL(binding),
 		egressMetric: egressMetric,
 	}
+	w.shared = acquireSharedConn(binding, skipCertVerify, df)
 
 	return w
 }
@@ -89,7 +101,15 @@ func (w *TCPWriter) connect() (net.Conn, error) {
 }
 
 // Close tears down any active connections to the drain and prevents reconnect.
+// A shared connection is only closed once no other binding uses it.
 func (w *TCPWriter) Close() error {
+	if w.shared != nil {
+		w.shared.pool.release(w.shared)
+		w.shared = nil
+
+		return nil
+	}
+
 	if w.conn != nil {
 		err := w.conn.Close()
 		w.conn = nil
@@ -100,106 +120,180 @@ func (w *TCPWriter) Close() error {
 	return nil
 }
 
-func generateRFC5424Messages(
-	env *loggregator_v2.Envelope,
-	hostname string,
-	appID string,
-) []rfc5424.Message {
-	switch env.GetMessage().(type) {
+// envelopeMessage holds the fields of one message of an envelope. Logs,
+// counters, timers and events make one message, gauges one per metric. It
+// is shared by the RFC 5424 and JSON formats so that both contain the same
+// messages.
+type envelopeMessage struct {
+	priority  rfc5424.Priority
+	timestamp time.Time
+	processID string
+	payload   []byte
+
+	gauge   *envelopeGauge
+	counter *loggregator_v2.Counter
+	timer   *loggregator_v2.Timer
+	event   *loggregator_v2.Event
+}
+
+type envelopeGauge struct {
+	name  string
+	value float64
+	unit  string
+}
+
+func envelopeMessages(env *loggregator_v2.Envelope) []envelopeMessage {
+	timestamp := time.Unix(0, env.GetTimestamp()).UTC()
+	metric := envelopeMessage{
+		priority:  rfc5424.Info + rfc5424.User,
+		timestamp: timestamp,
+		processID: fmt.Sprintf("[%s]", env.InstanceId),
+		payload:   []byte("\n"),
+	}
+
+	switch m := env.GetMessage().(type) {
 	case *loggregator_v2.Envelope_Log:
-		return []rfc5424.Message{
+		return []envelopeMessage{
 			{
-				Priority:  generatePriority(env.GetLog().Type),
-				Timestamp: time.Unix(0, env.GetTimestamp()).UTC(),
-				Hostname:  hostname,
-				AppName:   appID,
-				ProcessID: generateProcessID(
+				priority:  generatePriority(m.Log.Type),
+				timestamp: timestamp,
+				processID: generateProcessID(
 					env.Tags["source_type"],
 					env.InstanceId,
 				),
-				Message: appendNewline(removeNulls(env.GetLog().Payload)),
+				payload: appendNewline(removeNulls(m.Log.Payload)),
 			},
 		}
 	case *loggregator_v2.Envelope_Gauge:
-		gauges := make([]rfc5424.Message, 0, 5)
-
-		for name, g := range env.GetGauge().GetMetrics() {
-			gauges = append(gauges, rfc5424.Message{
-				Priority:  rfc5424.Info + rfc5424.User,
-				Timestamp: time.Unix(0, env.GetTimestamp()).UTC(),
-				Hostname:  hostname,
-				AppName:   appID,
-				ProcessID: fmt.Sprintf("[%s]", env.InstanceId),
-				Message:   []byte("\n"),
-				StructuredData: []rfc5424.StructuredData{
-					{
-						ID: gaugeStructuredDataID,
-						Parameters: []rfc5424.SDParam{
-							{
-								Name:  "name",
-								Value: name,
-							},
-							{
-								Name:  "value",
-								Value: strconv.FormatFloat(g.GetValue(), 'g', -1, 64),
-							},
-							{
-								Name:  "unit",
-								Value: g.GetUnit(),
-							},
-						},
-					},
-				},
-			})
+		gauges := make([]envelopeMessage, 0, len(m.Gauge.GetMetrics()))
+
+		for name, g := range m.Gauge.GetMetrics() {
+			msg := metric
+			msg.gauge = &envelopeGauge{
+				name:  name,
+				value: g.GetValue(),
+				unit:  g.GetUnit(),
+			}
+			gauges = append(gauges, msg)
 		}
 		return gauges
-
 	case *loggregator_v2.Envelope_Counter:
-		return []rfc5424.Message{
-			{
-				Priority:  rfc5424.Info + rfc5424.User,
-				Timestamp: time.Unix(0, env.GetTimestamp()).UTC(),
-				Hostname:  hostname,
-				AppName:   appID,
-				ProcessID: fmt.Sprintf("[%s]", env.InstanceId),
-				Message:   []byte("\n"),
-				StructuredData: []rfc5424.StructuredData{
-					{
-						ID: counterStructuredDataID,
-						Parameters: []rfc5424.SDParam{
-							{
-								Name:  "name",
-								Value: env.GetCounter().GetName(),
-							},
-							{
-								Name:  "total",
-								Value: fmt.Sprint(env.GetCounter().GetTotal()),
-							},
-							{
-								Name:  "delta",
-								Value: fmt.Sprint(env.GetCounter().GetDelta()),
-							},
-						},
-					},
-				},
+		metric.counter = m.Counter
+	case *loggregator_v2.Envelope_Timer:
+		metric.timer = m.Timer
+	case *loggregator_v2.Envelope_Event:
+		metric.event = m.Event
+	default:
+		return nil
+	}
+
+	return []envelopeMessage{metric}
+}
+
+// structuredData returns the structured data element that carries the
+// metric, timer or event of the message.
+func (m envelopeMessage) structuredData() []rfc5424.StructuredData {
+	var sd rfc5424.StructuredData
+	switch {
+	case m.gauge != nil:
+		sd = rfc5424.StructuredData{
+			ID: gaugeStructuredDataID,
+			Parameters: []rfc5424.SDParam{
+				{Name: "name", Value: m.gauge.name},
+				{Name: "value", Value: strconv.FormatFloat(m.gauge.value, 'g', -1, 64)},
+				{Name: "unit", Value: m.gauge.unit},
+			},
+		}
+	case m.counter != nil:
+		sd = rfc5424.StructuredData{
+			ID: counterStructuredDataID,
+			Parameters: []rfc5424.SDParam{
+				{Name: "name", Value: m.counter.GetName()},
+				{Name: "total", Value: fmt.Sprint(m.counter.GetTotal())},
+				{Name: "delta", Value: fmt.Sprint(m.counter.GetDelta())},
+			},
+		}
+	case m.timer != nil:
+		sd = rfc5424.StructuredData{
+			ID: timerStructuredDataID,
+			Parameters: []rfc5424.SDParam{
+				{Name: "name", Value: m.timer.GetName()},
+				{Name: "start", Value: fmt.Sprint(m.timer.GetStart())},
+				{Name: "stop", Value: fmt.Sprint(m.timer.GetStop())},
+				{Name: "duration", Value: fmt.Sprint(m.timer.GetStop() - m.timer.GetStart())},
+			},
+		}
+	case m.event != nil:
+		sd = rfc5424.StructuredData{
+			ID: eventStructuredDataID,
+			Parameters: []rfc5424.SDParam{
+				{Name: "title", Value: validUTF8(m.event.GetTitle())},
+				{Name: "body", Value: validUTF8(m.event.GetBody())},
 			},
 		}
 	default:
-		return []rfc5424.Message{}
+		return nil
 	}
+
+	return []rfc5424.StructuredData{sd}
+}
+
+func generateRFC5424Messages(
+	env *loggregator_v2.Envelope,
+	hostname string,
+	appID string,
+	tags *tagFilter,
+) []rfc5424.Message {
+	tagData := tags.structuredData(env.Tags)
+
+	entries := envelopeMessages(env)
+	msgs := make([]rfc5424.Message, 0, len(entries))
+	for _, m := range entries {
+		msgs = append(msgs, rfc5424.Message{
+			Priority:       m.priority,
+			Timestamp:      m.timestamp,
+			Hostname:       hostname,
+			AppName:        appID,
+			ProcessID:      m.processID,
+			Message:        m.payload,
+			StructuredData: append(m.structuredData(), tagData...),
+		})
+	}
+
+	return msgs
 }
 
 // Write writes an envelope to the syslog drain connection.
 func (w *TCPWriter) Write(env *loggregator_v2.Envelope) error {
-	msgs := generateRFC5424Messages(env, w.hostname, w.appID)
+	msgs, err := w.formatter.format(env)
+	if err != nil {
+		if w.shared == nil {
+			_ = w.Close()
+		}
+
+		return err
+	}
+
+	if w.shared != nil {
+		framed := make([][]byte, 0, len(msgs))
+		for _, b := range msgs {
+			framed = append(framed, w.framing.frame(b))
+		}
+
+		n, err := w.shared.write(framed, w.writeTimeout)
+		w.egressMetric.Increment(uint64(n))
+
+		return err
+	}
+
 	conn, err := w.connection()
 	if err != nil {
 		return err
 	}
 
-	for _, msg := range msgs {
+	for _, b := range msgs {
 		conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
-		_, err = msg.WriteTo(conn)
+		_, err = conn.Write(w.framing.frame(b))
 		if err != nil {
 			_ = w.Close()
 
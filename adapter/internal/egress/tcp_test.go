@@ -153,11 +153,43 @@ var _ = Describe("TCPWriter", func() {
 			Expect(actual).To(Equal(expected))
 		})
 
-		It("ignores non-log/gauge envelopes", func() {
-			counterEnv := buildTimerEnvelope()
+		It("writes timers to the tcp drain", func() {
+			env := buildTimerEnvelope()
+			Expect(writer.Write(env)).To(Succeed())
+
+			conn, err := listener.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			buf := bufio.NewReader(conn)
+
+			actual, err := buf.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(actual).To(Equal(
+				"139 <14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [1] - [timer@47450 name=\"http\" start=\"1000\" stop=\"3500\" duration=\"2500\"] \n",
+			))
+		})
+
+		It("writes events to the tcp drain", func() {
+			env := buildEventEnvelope()
+			Expect(writer.Write(env)).To(Succeed())
+
+			conn, err := listener.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			buf := bufio.NewReader(conn)
+
+			actual, err := buf.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(actual).To(Equal(
+				"123 <14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [1] - [event@47450 title=\"app crashed\" body=\"exit [1\\]\"] \n",
+			))
+		})
+
+		It("ignores envelopes without a message", func() {
+			emptyEnv := &loggregator_v2.Envelope{Timestamp: 12345678}
 			logEnv := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
 
-			Expect(writer.Write(counterEnv)).To(Succeed())
+			Expect(writer.Write(emptyEnv)).To(Succeed())
 			Expect(writer.Write(logEnv)).To(Succeed())
 
 			conn, err := listener.Accept()
@@ -195,6 +227,160 @@ var _ = Describe("TCPWriter", func() {
 		})
 	})
 
+	DescribeTable("frames messages according to the drain framing", func(framing, expected string) {
+		binding.URL.RawQuery = framing
+		writer := egress.NewTCPWriter(
+			binding,
+			netConf,
+			false,
+			&testhelper.SpyMetric{},
+		)
+		defer writer.Close()
+
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(writer.Write(env)).To(Succeed())
+
+		conn, err := listener.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		buf := make([]byte, 2*len(expected))
+		_, err = io.ReadFull(conn, buf)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(string(buf)).To(Equal(expected + expected))
+	},
+		Entry("default", "", "89 <14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - - just a test\n"),
+		Entry("octet", "framing=octet", "89 <14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - - just a test\n"),
+		Entry("lf", "framing=lf", "<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - - just a test\n"),
+		Entry("nul", "framing=nul", "<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - - just a test\n\x00"),
+	)
+
+	It("escapes line feeds inside messages with lf framing", func() {
+		binding.URL.RawQuery = "framing=lf"
+		writer := egress.NewTCPWriter(
+			binding,
+			netConf,
+			false,
+			&testhelper.SpyMetric{},
+		)
+		defer writer.Close()
+
+		env := buildLogEnvelope("APP", "2", "Exception\n\tat Main.run(Main.java:10)", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		conn, err := listener.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(line).To(HaveSuffix("[APP/2] - - Exception#012\tat Main.run(Main.java:10)\n"))
+	})
+
+	DescribeTable("writes envelope tags as structured data", func(query string, env *loggregator_v2.Envelope, expected string) {
+		binding.URL.RawQuery = "framing=lf&" + query
+		writer := egress.NewTCPWriter(
+			binding,
+			netConf,
+			false,
+			&testhelper.SpyMetric{},
+		)
+		defer writer.Close()
+
+		env.Tags["deployment"] = `cf "prod"`
+		env.Tags["job"] = `router[0]\z`
+		env.Tags["bad name=x"] = "v"
+		Expect(writer.Write(env)).To(Succeed())
+
+		conn, err := listener.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := bufio.NewReader(conn).ReadString('\n')
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(actual).To(Equal(expected))
+	},
+		Entry("without include-tags", "",
+			buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT),
+			"<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - - just a test\n",
+		),
+		Entry("include-tags=true", "include-tags=true",
+			buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT),
+			`<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 bad_name_x="v" deployment="cf \"prod\"" job="router[0\]\\z" source_type="APP"] just a test`+"\n",
+		),
+		Entry("allowlist for logs", "include-tags=job,deployment",
+			buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT),
+			`<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 deployment="cf \"prod\"" job="router[0\]\\z"] just a test`+"\n",
+		),
+		Entry("allowlist for counters", "include-tags=job",
+			withTags(buildCounterEnvelope("1")),
+			`<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [1] - [counter@47450 name="some-counter" total="99" delta="1"][tags@47450 job="router[0\]\\z"] `+"\n",
+		),
+	)
+
+	DescribeTable("writes RFC 3164 messages", func(query string, env *loggregator_v2.Envelope, expected string) {
+		binding.URL.RawQuery = "framing=lf&format=rfc3164&" + query
+		writer := egress.NewTCPWriter(
+			binding,
+			netConf,
+			false,
+			&testhelper.SpyMetric{},
+		)
+		defer writer.Close()
+
+		Expect(writer.Write(env)).To(Succeed())
+
+		conn, err := listener.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := bufio.NewReader(conn).ReadString('\n')
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(actual).To(Equal(expected))
+	},
+		Entry("logs", "",
+			buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_ERR),
+			"<11>Jan  1 00:00:00 test-hostname test-app-id[APP/2]: just a test\n",
+		),
+		Entry("timezone", "timezone=America/New_York",
+			buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT),
+			"<14>Dec 31 19:00:00 test-hostname test-app-id[APP/2]: just a test\n",
+		),
+		Entry("counters", "",
+			buildCounterEnvelope("1"),
+			`<14>Jan  1 00:00:00 test-hostname test-app-id[1]: [counter@47450 name="some-counter" total="99" delta="1"]`+"\n",
+		),
+		Entry("tags", "include-tags=source_type",
+			buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT),
+			`<14>Jan  1 00:00:00 test-hostname test-app-id[APP/2]: [tags@47450 source_type="APP"] just a test`+"\n",
+		),
+	)
+
+	DescribeTable("shortens long app IDs in the RFC 3164 tag", func(hostname, expected string) {
+		b := &egress.URLBinding{
+			AppID:    "3e0b1150-14b8-4a20-a1c5-d9e296f198ae",
+			Hostname: hostname,
+			URL:      binding.URL,
+		}
+		b.URL.RawQuery = "framing=lf&format=rfc3164"
+		writer := egress.NewTCPWriter(b, netConf, false, &testhelper.SpyMetric{})
+		defer writer.Close()
+
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		conn, err := listener.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := bufio.NewReader(conn).ReadString('\n')
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(actual).To(Equal(expected))
+	},
+		Entry("with the app name", "org.space.my app",
+			"<14>Jan  1 00:00:00 org.space.my-app my_app[APP/2]: just a test\n",
+		),
+		Entry("by truncating without a hostname", "",
+			"<14>Jan  1 00:00:00 - 3e0b1150-14b8-4a20-a1c5-d9e296f1[APP/2]: just a test\n",
+		),
+	)
+
 	Describe("when write fails to connect", func() {
 		It("write returns an error", func() {
 			env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
@@ -309,10 +495,29 @@ func buildGaugeEnvelope(srcInstance string) *loggregator_v2.Envelope {
 
 func buildTimerEnvelope() *loggregator_v2.Envelope {
 	return &loggregator_v2.Envelope{
-		Timestamp: 12345678,
-		SourceId:  "source-id",
+		Timestamp:  12345678,
+		SourceId:   "source-id",
+		InstanceId: "1",
 		Message: &loggregator_v2.Envelope_Timer{
-			Timer: &loggregator_v2.Timer{},
+			Timer: &loggregator_v2.Timer{
+				Name:  "http",
+				Start: 1000,
+				Stop:  3500,
+			},
+		},
+	}
+}
+
+func buildEventEnvelope() *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		Timestamp:  12345678,
+		SourceId:   "source-id",
+		InstanceId: "1",
+		Message: &loggregator_v2.Envelope_Event{
+			Event: &loggregator_v2.Event{
+				Title: "app crashed",
+				Body:  "exit [1]",
+			},
 		},
 	}
 }
@@ -331,3 +536,8 @@ func buildCounterEnvelope(srcInstance string) *loggregator_v2.Envelope {
 		},
 	}
 }
+
+func withTags(env *loggregator_v2.Envelope) *loggregator_v2.Envelope {
+	env.Tags = map[string]string{}
+	return env
+}
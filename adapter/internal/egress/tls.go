@@ -2,10 +2,16 @@ package egress
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
 	"net"
+	"os"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/scalable-syslog/internal/api"
 )
 
 // TLSWriter represents a syslog writer that connects over unencrypted TCP.
@@ -20,34 +26,156 @@ type NetworkTimeoutConfig struct {
 	WriteTimeout time.Duration
 }
 
+// TLSWriterConstructor returns a WriterConstructor for syslog-tls drains
+// that connect with the given TLS config. A nil config uses
+// api.NewTLSConfig.
+func TLSWriterConstructor(tlsConfig *tls.Config) WriterConstructor {
+	return WriterConstructor(func(
+		binding *URLBinding,
+		netConf NetworkTimeoutConfig,
+		skipCertVerify bool,
+		egressMetric pulseemitter.CounterMetric,
+	) WriteCloser {
+		conf, confErr := drainTLSConfig(tlsConfig, binding, skipCertVerify)
+
+		dialer := &net.Dialer{
+			Timeout:   netConf.DialTimeout,
+			KeepAlive: netConf.Keepalive,
+		}
+		df := func(addr string) (net.Conn, error) {
+			if confErr != nil {
+				return nil, confErr
+			}
+
+			if binding.proxy != nil {
+				return binding.proxy.dialTLS(dialer, addr, conf)
+			}
+
+			return tls.DialWithDialer(dialer, "tcp", addr, conf)
+		}
+
+		return &TLSWriter{
+			TCPWriter{
+				url:          binding.URL,
+				appID:        binding.AppID,
+				hostname:     binding.Hostname,
+				writeTimeout: netConf.WriteTimeout,
+				dialFunc:     df,
+				scheme:       "syslog-tls",
+				framing:      framingFromURL(binding.URL),
+				formatter:    syslogFormatterFromURL(binding),
+				egressMetric: egressMetric,
+				shared:       acquireSharedConn(binding, skipCertVerify, df),
+			},
+		}
+	})
+}
+
+// NewTLSWriter creates a new TLS syslog writer using api.NewTLSConfig.
 func NewTLSWriter(
 	binding *URLBinding,
 	netConf NetworkTimeoutConfig,
 	skipCertVerify bool,
 	egressMetric pulseemitter.CounterMetric,
 ) WriteCloser {
+	return TLSWriterConstructor(nil)(binding, netConf, skipCertVerify, egressMetric)
+}
+
+// drainTLSConfig returns a copy of the base config for a drain. The ca query
+// parameter replaces the trusted CAs with the given PEM certificates and the
+// servername query parameter sets the name used for SNI and verification.
+// The client certificate of the binding, if any, is presented when the drain
+// asks for one.
+func drainTLSConfig(base *tls.Config, b *URLBinding, skipCertVerify bool) (*tls.Config, error) {
+	if base == nil {
+		base = api.NewTLSConfig()
+	}
+
+	conf := base.Clone()
+	conf.InsecureSkipVerify = skipCertVerify
+
+	if b.ClientCertFile != "" || b.ClientKeyFile != "" {
+		cert := &clientCertificate{
+			certFile: b.ClientCertFile,
+			keyFile:  b.ClientKeyFile,
+		}
+		if _, err := cert.load(); err != nil {
+			return nil, err
+		}
+		conf.GetClientCertificate = cert.get
+	}
+
+	q := b.URL.Query()
+	if serverName := q.Get("servername"); serverName != "" {
+		conf.ServerName = serverName
+	}
+
+	if ca := q.Get("ca"); ca != "" {
+		pool := x509.NewCertPool()
+		if ok := pool.AppendCertsFromPEM([]byte(ca)); !ok {
+			return nil, errors.New("invalid ca query parameter")
+		}
+		conf.RootCAs = pool
+	}
+
+	return conf, nil
+}
+
+// clientCertificate loads a client certificate from disk. The files are
+// checked on every handshake so that a rotated certificate is picked up by
+// the next connection.
+type clientCertificate struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func (c *clientCertificate) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := c.load()
+	if err != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.cert == nil {
+			return nil, err
+		}
 
-	dialer := &net.Dialer{
-		Timeout:   netConf.DialTimeout,
-		KeepAlive: netConf.Keepalive,
+		log.Printf("failed to reload client certificate %s, using previous: %s", c.certFile, err)
+		return c.cert, nil
 	}
-	df := func(addr string) (net.Conn, error) {
-		return tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
-			InsecureSkipVerify: skipCertVerify,
-		})
+
+	return cert, nil
+}
+
+// load reads the certificate and key if either changed since the last load.
+func (c *clientCertificate) load() (*tls.Certificate, error) {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cert != nil && certInfo.ModTime().Equal(c.certMod) && keyInfo.ModTime().Equal(c.keyMod) {
+		return c.cert, nil
 	}
 
-	w := &TLSWriter{
-		TCPWriter{
-			url:          binding.URL,
-			appID:        binding.AppID,
-			hostname:     binding.Hostname,
-			writeTimeout: netConf.WriteTimeout,
-			dialFunc:     df,
-			scheme:       "syslog-tls",
-			egressMetric: egressMetric,
-		},
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, err
 	}
+	c.cert = &cert
+	c.certMod = certInfo.ModTime()
+	c.keyMod = keyInfo.ModTime()
 
-	return w
+	return c.cert, nil
 }
@@ -2,10 +2,20 @@ package egress_test
 
 import (
 	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net"
 	"net/url"
+	"os"
+	"path/filepath"
 	"time"
 
 	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
@@ -86,3 +96,261 @@ var _ = Describe("TLSWriter", func() {
 		Expect(egressCounter.Delta()).To(Equal(uint64(1)))
 	})
 })
+
+var _ = Describe("TLSWriter with a client certificate", func() {
+	var (
+		listener  net.Listener
+		ca        *testCA
+		dir       string
+		binding   *egress.URLBinding
+		clientCNs chan string
+		env       = buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		netConf   = egress.NetworkTimeoutConfig{
+			WriteTimeout: time.Second,
+			DialTimeout:  time.Second,
+		}
+	)
+
+	writeClientCert := func(name string) {
+		certPEM, keyPEM := ca.issue(name, x509.ExtKeyUsageClientAuth)
+		Expect(ioutil.WriteFile(binding.ClientCertFile, certPEM, 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(binding.ClientKeyFile, keyPEM, 0600)).To(Succeed())
+
+		// Make sure the modification time changes between rotations.
+		mod := time.Now().Add(time.Duration(len(clientCNs)+1) * time.Minute)
+		Expect(os.Chtimes(binding.ClientCertFile, mod, mod)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ca = newTestCA()
+		serverPEM, serverKey := ca.issue("collector.internal", x509.ExtKeyUsageServerAuth)
+		serverCert, err := tls.X509KeyPair(serverPEM, serverKey)
+		Expect(err).ToNot(HaveOccurred())
+
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    ca.pool(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		clientCNs = make(chan string, 10)
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				tlsConn := conn.(*tls.Conn)
+				if err := tlsConn.Handshake(); err != nil {
+					conn.Close()
+					continue
+				}
+				clientCNs <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+				go conn.Read(make([]byte, 1024))
+			}
+		}()
+
+		dir, err = ioutil.TempDir("", "client-cert")
+		Expect(err).ToNot(HaveOccurred())
+
+		u, _ := url.Parse(fmt.Sprintf("syslog-tls://%s?servername=collector.internal", listener.Addr()))
+		binding = &egress.URLBinding{
+			AppID:          "test-app-id",
+			Hostname:       "test-hostname",
+			URL:            u,
+			ClientCertFile: filepath.Join(dir, "client.crt"),
+			ClientKeyFile:  filepath.Join(dir, "client.key"),
+		}
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("presents the client certificate", func() {
+		writeClientCert("client-1")
+		writer := egress.TLSWriterConstructor(&tls.Config{RootCAs: ca.pool()})(binding, netConf, false, &testhelper.SpyMetric{})
+		defer writer.Close()
+
+		Expect(writer.Write(env)).To(Succeed())
+		Eventually(clientCNs).Should(Receive(Equal("client-1")))
+	})
+
+	It("picks up a rotated certificate on the next connection", func() {
+		writeClientCert("client-1")
+		writer := egress.TLSWriterConstructor(&tls.Config{RootCAs: ca.pool()})(binding, netConf, false, &testhelper.SpyMetric{})
+		defer writer.Close()
+
+		Expect(writer.Write(env)).To(Succeed())
+		Eventually(clientCNs).Should(Receive(Equal("client-1")))
+
+		writeClientCert("client-2")
+		Expect(writer.Close()).To(Succeed())
+		Expect(writer.Write(env)).To(Succeed())
+		Eventually(clientCNs).Should(Receive(Equal("client-2")))
+	})
+
+	It("fails when the certificate cannot be loaded", func() {
+		writer := egress.TLSWriterConstructor(&tls.Config{RootCAs: ca.pool()})(binding, netConf, false, &testhelper.SpyMetric{})
+
+		Expect(writer.Write(env)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("TLSWriter with a private CA", func() {
+	var (
+		listener net.Listener
+		caPEM    []byte
+		env      = buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		netConf  = egress.NetworkTimeoutConfig{
+			WriteTimeout: time.Second,
+			DialTimeout:  time.Second,
+		}
+	)
+
+	BeforeEach(func() {
+		var serverCert tls.Certificate
+		caPEM, serverCert = generateCertificates("collector.internal")
+
+		var err error
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go conn.Read(make([]byte, 1024))
+			}
+		}()
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	write := func(query url.Values, tlsConfig *tls.Config) error {
+		u, _ := url.Parse(fmt.Sprintf("syslog-tls://%s?%s", listener.Addr(), query.Encode()))
+		binding := &egress.URLBinding{
+			AppID:    "test-app-id",
+			Hostname: "test-hostname",
+			URL:      u,
+		}
+
+		writer := egress.TLSWriterConstructor(tlsConfig)(binding, netConf, false, &testhelper.SpyMetric{})
+		defer writer.Close()
+
+		return writer.Write(env)
+	}
+
+	It("trusts the CA and server name given by the drain URL", func() {
+		query := url.Values{
+			"ca":         {string(caPEM)},
+			"servername": {"collector.internal"},
+		}
+
+		Expect(write(query, nil)).To(Succeed())
+	})
+
+	It("trusts the CA of the adapter config", func() {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(caPEM)
+		tlsConfig := &tls.Config{RootCAs: pool}
+
+		Expect(write(url.Values{"servername": {"collector.internal"}}, tlsConfig)).To(Succeed())
+	})
+
+	It("fails when the server name does not match", func() {
+		query := url.Values{
+			"ca": {string(caPEM)},
+		}
+
+		Expect(write(query, nil)).ToNot(Succeed())
+	})
+
+	It("fails without the CA", func() {
+		Expect(write(url.Values{"servername": {"collector.internal"}}, nil)).ToNot(Succeed())
+	})
+
+	It("fails with an invalid CA", func() {
+		Expect(write(url.Values{"ca": {"garbage"}}, nil)).To(MatchError("invalid ca query parameter"))
+	})
+})
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCA() *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+
+	return &testCA{cert: cert, key: key, der: der}
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.der})
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	return pool
+}
+
+// issue returns a PEM encoded certificate and key for the given name.
+func (ca *testCA) issue(name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).ToNot(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// generateCertificates returns a PEM encoded CA certificate and a server
+// certificate for the given name signed by it.
+func generateCertificates(name string) ([]byte, tls.Certificate) {
+	ca := newTestCA()
+	certPEM, keyPEM := ca.issue(name, x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	Expect(err).ToNot(HaveOccurred())
+
+	return ca.pem(), cert
+}
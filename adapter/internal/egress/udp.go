@@ -0,0 +1,159 @@
+package egress
+
+import (
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+const (
+	// defaultUDPMaxDatagramSize is the largest datagram RFC 5426 says
+	// receivers SHOULD be able to accept.
+	defaultUDPMaxDatagramSize = 2048
+
+	// maxUDPDatagramSize is the largest payload that fits in a single IPv4
+	// UDP datagram.
+	maxUDPDatagramSize = 65507
+
+	// minUDPDatagramSize is the smallest datagram RFC 5426 says receivers
+	// MUST be able to accept.
+	minUDPDatagramSize = 480
+)
+
+// UDPWriter represents a syslog writer that sends each message in its own
+// UDP datagram as described by RFC 5426. Messages that do not fit into a
+// single datagram are truncated. This writer is not meant to be used from
+// multiple goroutines.
+type UDPWriter struct {
+	url             *url.URL
+	appID           string
+	hostname        string
+	dialTimeout     time.Duration
+	writeTimeout    time.Duration
+	maxDatagramSize int
+	formatter       syslogFormatter
+	conn            net.Conn
+
+	egressMetric pulseemitter.CounterMetric
+}
+
+// NewUDPWriter creates a new UDP syslog writer. The maximum datagram size
+// can be set with the max-datagram-size query parameter on the drain URL.
+func NewUDPWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	skipCertVerify bool,
+	egressMetric pulseemitter.CounterMetric,
+) WriteCloser {
+	return &UDPWriter{
+		url:             binding.URL,
+		appID:           binding.AppID,
+		hostname:        binding.Hostname,
+		dialTimeout:     netConf.DialTimeout,
+		writeTimeout:    netConf.WriteTimeout,
+		maxDatagramSize: udpMaxDatagramSize(binding.URL),
+		formatter:       syslogFormatterFromURL(binding),
+		egressMetric:    egressMetric,
+	}
+}
+
+// Write writes an envelope to the syslog drain, one datagram per message.
+func (w *UDPWriter) Write(env *loggregator_v2.Envelope) error {
+	msgs, err := w.formatter.format(env)
+	if err != nil {
+		return err
+	}
+
+	conn, err := w.connection()
+	if err != nil {
+		return err
+	}
+
+	for _, b := range msgs {
+		conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
+		_, err = conn.Write(truncateDatagram(b, w.maxDatagramSize))
+		if err != nil {
+			_ = w.Close()
+
+			return err
+		}
+
+		w.egressMetric.Increment(1)
+	}
+
+	return nil
+}
+
+// Close tears down the UDP socket.
+func (w *UDPWriter) Close() error {
+	if w.conn != nil {
+		err := w.conn.Close()
+		w.conn = nil
+
+		return err
+	}
+
+	return nil
+}
+
+func (w *UDPWriter) connection() (net.Conn, error) {
+	if w.conn != nil {
+		return w.conn, nil
+	}
+
+	dialer := &net.Dialer{
+		Timeout: w.dialTimeout,
+	}
+	conn, err := dialer.Dial("udp", w.url.Host)
+	if err != nil {
+		return nil, err
+	}
+	w.conn = conn
+
+	log.Printf("created udp socket to syslog drain: %s", w.url.Host)
+
+	return conn, nil
+}
+
+func udpMaxDatagramSize(u *url.URL) int {
+	size, err := strconv.Atoi(u.Query().Get("max-datagram-size"))
+	if err != nil {
+		return defaultUDPMaxDatagramSize
+	}
+
+	if size < minUDPDatagramSize {
+		return minUDPDatagramSize
+	}
+
+	if size > maxUDPDatagramSize {
+		return maxUDPDatagramSize
+	}
+
+	return size
+}
+
+// truncateDatagram cuts a marshaled message down to max bytes without
+// splitting a multi-byte UTF-8 character.
+func truncateDatagram(b []byte, max int) []byte {
+	if len(b) <= max {
+		return b
+	}
+
+	b = b[:max]
+
+	start := len(b) - 1
+	for start > 0 && len(b)-start < utf8.UTFMax && !utf8.RuneStart(b[start]) {
+		start--
+	}
+	if start >= 0 && !utf8.FullRune(b[start:]) {
+		b = b[:start]
+	}
+
+	return b
+}
@@ -0,0 +1,119 @@
+package egress_test
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	"code.cloudfoundry.org/scalable-syslog/internal/testhelper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UDPWriter", func() {
+	var (
+		listener net.PacketConn
+		binding  *egress.URLBinding
+		netConf  = egress.NetworkTimeoutConfig{
+			WriteTimeout: time.Second,
+			DialTimeout:  100 * time.Millisecond,
+		}
+	)
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		binding = &egress.URLBinding{
+			AppID:    "test-app-id",
+			Hostname: "test-hostname",
+		}
+		binding.URL, _ = url.Parse(fmt.Sprintf("syslog-udp://%s", listener.LocalAddr()))
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	readDatagram := func() string {
+		buf := make([]byte, 65536)
+		listener.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := listener.ReadFrom(buf)
+		Expect(err).ToNot(HaveOccurred())
+
+		return string(buf[:n])
+	}
+
+	It("writes each message in its own datagram without framing", func() {
+		writer := egress.NewUDPWriter(binding, netConf, false, &testhelper.SpyMetric{})
+
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		Expect(readDatagram()).To(Equal(
+			"<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - - just a test\n",
+		))
+	})
+
+	It("writes one datagram per gauge metric", func() {
+		writer := egress.NewUDPWriter(binding, netConf, false, &testhelper.SpyMetric{})
+
+		Expect(writer.Write(buildGaugeEnvelope("1"))).To(Succeed())
+
+		var msgs []string
+		for i := 0; i < 5; i++ {
+			msgs = append(msgs, readDatagram())
+		}
+		Expect(msgs).To(ContainElement(
+			"<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [1] - [gauge@47450 name=\"cpu\" value=\"0.23\" unit=\"percentage\"] \n",
+		))
+	})
+
+	It("truncates messages larger than the max datagram size", func() {
+		binding.URL.RawQuery = "max-datagram-size=512"
+		writer := egress.NewUDPWriter(binding, netConf, false, &testhelper.SpyMetric{})
+
+		env := buildLogEnvelope("APP", "2", strings.Repeat("a", 1000), loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		msg := readDatagram()
+		Expect(msg).To(HaveLen(512))
+		Expect(msg).To(HavePrefix("<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - - aaaa"))
+	})
+
+	It("does not split multi-byte characters when truncating", func() {
+		binding.URL.RawQuery = "max-datagram-size=512"
+		writer := egress.NewUDPWriter(binding, netConf, false, &testhelper.SpyMetric{})
+
+		env := buildLogEnvelope("APP", "2", strings.Repeat("é", 500), loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		msg := readDatagram()
+		Expect(len(msg)).To(BeNumerically("<=", 512))
+		Expect(msg).To(HaveSuffix("é"))
+	})
+
+	It("emits an egress metric for each message", func() {
+		metric := &testhelper.SpyMetric{}
+		writer := egress.NewUDPWriter(binding, netConf, false, metric)
+
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		Expect(metric.Delta()).To(Equal(uint64(1)))
+	})
+
+	It("returns an error when the host cannot be resolved", func() {
+		binding.URL, _ = url.Parse("syslog-udp://localhost-garbage:9999")
+		writer := egress.NewUDPWriter(binding, netConf, false, &testhelper.SpyMetric{})
+
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(HaveOccurred())
+	})
+})
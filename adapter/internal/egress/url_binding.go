@@ -9,12 +9,26 @@ import (
 )
 
 // application is identified by AppID and Hostname. The syslog URL is
-// identified by URL.
+// identified by URL. ClientCertFile and ClientKeyFile optionally name the
+// client certificate presented to TLS drains.
 type URLBinding struct {
-	Context  context.Context
-	AppID    string
-	Hostname string
-	URL      *url.URL
+	Context        context.Context
+	AppID          string
+	Hostname       string
+	URL            *url.URL
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// connPool, if set, is used by syslog and syslog-tls writers to share
+	// connections with other bindings.
+	connPool *connectionPool
+
+	// proxy, if set, is used to connect to the drain.
+	proxy *Proxy
+
+	// dropped, if set, reports envelopes lost by the writers of the
+	// binding.
+	dropped func(missed int)
 }
 
 // Scheme is a convenience wrapper around the *url.URL Scheme field
@@ -22,6 +36,24 @@ func (u *URLBinding) Scheme() string {
 	return u.URL.Scheme
 }
 
+// reportDropped counts envelopes that a writer of the binding discarded and
+// tells the app about them.
+func (u *URLBinding) reportDropped(missed int) {
+	if u.dropped != nil && missed > 0 {
+		u.dropped(missed)
+	}
+}
+
+// ctx returns the context of the binding, or a background context for
+// bindings without one.
+func (u *URLBinding) ctx() context.Context {
+	if u.Context == nil {
+		return context.Background()
+	}
+
+	return u.Context
+}
+
 func buildBinding(c context.Context, b *v1.Binding) (*URLBinding, error) {
 	url, err := url.Parse(b.Drain)
 	if err != nil {
@@ -29,10 +61,12 @@ func buildBinding(c context.Context, b *v1.Binding) (*URLBinding, error) {
 	}
 
 	u := &URLBinding{
-		AppID:    b.AppId,
-		URL:      url,
-		Hostname: b.Hostname,
-		Context:  c,
+		AppID:          b.AppId,
+		URL:            url,
+		Hostname:       b.Hostname,
+		Context:        c,
+		ClientCertFile: b.ClientCertFile,
+		ClientKeyFile:  b.ClientKeyFile,
 	}
 
 	return u, nil
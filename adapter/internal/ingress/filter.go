@@ -0,0 +1,141 @@
+package ingress
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	v2 "code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+)
+
+// logFilter selects the log envelopes that are written to a drain. Other
+// envelope types are selected with the drain-type parameter instead.
+type logFilter struct {
+	include     *regexp.Regexp
+	exclude     *regexp.Regexp
+	logType     *v2.Log_Type
+	sourceTypes []string
+}
+
+// parseLogFilter reads the include, exclude, log-type and source-type drain
+// URL parameters. include and exclude are regular expressions matched
+// against the payload, log-type is out or err and source-type is a comma
+// separated list of source types, for example APP/PROC/WEB,RTR. It returns
+// nil when no filter is set.
+func parseLogFilter(q url.Values) (*logFilter, error) {
+	f := &logFilter{}
+	set := false
+
+	if s := q.Get("include"); s != "" {
+		r, err := regexp.Compile(s)
+		if err != nil {
+			return nil, errors.New("invalid include")
+		}
+		f.include = r
+		set = true
+	}
+
+	if s := q.Get("exclude"); s != "" {
+		r, err := regexp.Compile(s)
+		if err != nil {
+			return nil, errors.New("invalid exclude")
+		}
+		f.exclude = r
+		set = true
+	}
+
+	if s := q.Get("log-type"); s != "" {
+		t, ok := v2.Log_Type_value[strings.ToUpper(s)]
+		if !ok {
+			return nil, errors.New("invalid log-type")
+		}
+		logType := v2.Log_Type(t)
+		f.logType = &logType
+		set = true
+	}
+
+	if s := q.Get("source-type"); s != "" {
+		for _, t := range strings.Split(s, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				f.sourceTypes = append(f.sourceTypes, t)
+			}
+		}
+		set = true
+	}
+
+	if !set {
+		return nil, nil
+	}
+
+	return f, nil
+}
+
+// matches reports whether the envelope passes the filter.
+func (f *logFilter) matches(env *v2.Envelope) bool {
+	l := env.GetLog()
+	if l == nil {
+		return true
+	}
+
+	if f.logType != nil && l.GetType() != *f.logType {
+		return false
+	}
+
+	if len(f.sourceTypes) > 0 && !matchesSourceType(env.GetTags()["source_type"], f.sourceTypes) {
+		return false
+	}
+
+	if f.include != nil && !f.include.Match(l.GetPayload()) {
+		return false
+	}
+
+	if f.exclude != nil && f.exclude.Match(l.GetPayload()) {
+		return false
+	}
+
+	return true
+}
+
+// matchesSourceType reports whether the source type is one of types or
+// below one of them, so that APP also selects APP/PROC/WEB.
+func matchesSourceType(sourceType string, types []string) bool {
+	for _, t := range types {
+		if sourceType == t || strings.HasPrefix(sourceType, t+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filteredWriter drops the envelopes that do not pass the filter of a
+// binding.
+type filteredWriter struct {
+	w      egress.Writer
+	filter *logFilter
+	metric pulseemitter.CounterMetric
+}
+
+func newFilteredWriter(w egress.Writer, f *logFilter, metric pulseemitter.CounterMetric) egress.Writer {
+	if f == nil {
+		return w
+	}
+
+	return &filteredWriter{
+		w:      w,
+		filter: f,
+		metric: metric,
+	}
+}
+
+func (f *filteredWriter) Write(env *v2.Envelope) error {
+	if !f.filter.matches(env) {
+		f.metric.Increment(1)
+		return nil
+	}
+
+	return f.w.Write(env)
+}
@@ -0,0 +1,235 @@
+package ingress
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	v2 "code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	defaultMultilineMaxLines = 500
+	defaultMultilineMaxWait  = time.Second
+
+	// maxMultilineBytes bounds the size of a joined message. A line that
+	// would push a message over it starts a new message instead.
+	maxMultilineBytes = 64 * 1024
+)
+
+// defaultContinuationPattern matches the continuation lines of Java and
+// Python stack traces.
+var defaultContinuationPattern = regexp.MustCompile(`^(\s|at |Caused by:|\.\.\. \d+ more)`)
+
+// multilineConfig configures the joining of log lines of a binding.
+type multilineConfig struct {
+	pattern  *regexp.Regexp
+	maxLines int
+	maxWait  time.Duration
+}
+
+// parseMultiline reads the multiline drain URL parameters. Joining is
+// enabled by multiline=true or by a custom multiline-pattern and limited by
+// multiline-max-lines and multiline-max-wait. It returns nil when joining is
+// not enabled.
+func parseMultiline(q url.Values) (*multilineConfig, error) {
+	pattern := q.Get("multiline-pattern")
+	if q.Get("multiline") != "true" && pattern == "" {
+		return nil, nil
+	}
+
+	c := &multilineConfig{
+		pattern:  defaultContinuationPattern,
+		maxLines: defaultMultilineMaxLines,
+		maxWait:  defaultMultilineMaxWait,
+	}
+
+	if pattern != "" {
+		p, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New("invalid multiline-pattern")
+		}
+		c.pattern = p
+	}
+
+	if s := q.Get("multiline-max-lines"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, errors.New("invalid multiline-max-lines")
+		}
+		c.maxLines = n
+	}
+
+	if s := q.Get("multiline-max-wait"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nil, errors.New("invalid multiline-max-wait")
+		}
+		c.maxWait = d
+	}
+
+	return c, nil
+}
+
+// multilineWriter joins consecutive log lines of a source instance that
+// match the continuation pattern into a single envelope. Other envelopes are
+// passed on as they are.
+type multilineWriter struct {
+	w    egress.Writer
+	conf multilineConfig
+	now  func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*multilineMessage
+	stopped bool
+}
+
+// multilineMessage is a message that is still being joined.
+type multilineMessage struct {
+	env   *v2.Envelope
+	lines [][]byte
+	size  int
+	start time.Time
+}
+
+// newMultilineWriter returns w if conf is nil. Otherwise messages are
+// flushed once they are older than the max wait and when the returned stop
+// function is called. The stop function must be called before the writers
+// it writes to are closed. Envelopes written after stop are passed on as
+// they are.
+func newMultilineWriter(w egress.Writer, conf *multilineConfig) (egress.Writer, func()) {
+	if conf == nil {
+		return w, func() {}
+	}
+
+	m := &multilineWriter{
+		w:       w,
+		conf:    *conf,
+		now:     time.Now,
+		pending: make(map[string]*multilineMessage),
+	}
+	done := make(chan struct{})
+	go m.run(done)
+
+	return m, func() {
+		close(done)
+		m.stop()
+	}
+}
+
+// Write buffers log envelopes until a line that does not continue the
+// message of its source instance arrives or a limit is reached.
+func (m *multilineWriter) Write(env *v2.Envelope) error {
+	l := env.GetLog()
+	if l == nil {
+		return m.w.Write(env)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		return m.w.Write(env)
+	}
+
+	key := multilineKey(env)
+	line := bytes.TrimRight(l.GetPayload(), "\r\n")
+
+	msg, ok := m.pending[key]
+	if ok && m.conf.pattern.Match(line) && msg.size+1+len(line) <= maxMultilineBytes {
+		msg.lines = append(msg.lines, line)
+		msg.size += 1 + len(line)
+		if len(msg.lines) < m.conf.maxLines {
+			return nil
+		}
+
+		delete(m.pending, key)
+		return m.flush(msg)
+	}
+
+	var err error
+	if ok {
+		delete(m.pending, key)
+		err = m.flush(msg)
+	}
+
+	m.pending[key] = &multilineMessage{
+		env:   env,
+		lines: [][]byte{line},
+		size:  len(line),
+		start: m.now(),
+	}
+
+	return err
+}
+
+func (m *multilineWriter) run(done <-chan struct{}) {
+	interval := m.conf.maxWait / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			m.flushOlderThan(m.conf.maxWait)
+		}
+	}
+}
+
+func (m *multilineWriter) flushOlderThan(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for key, msg := range m.pending {
+		if now.Sub(msg.start) < d {
+			continue
+		}
+
+		delete(m.pending, key)
+		_ = m.flush(msg)
+	}
+}
+
+// stop flushes all pending messages and stops joining lines.
+func (m *multilineWriter) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, msg := range m.pending {
+		delete(m.pending, key)
+		_ = m.flush(msg)
+	}
+	m.stopped = true
+}
+
+// flush writes the joined message. The envelope of the first line is kept
+// with the lines joined by newlines as its payload.
+func (m *multilineWriter) flush(msg *multilineMessage) error {
+	env := msg.env
+	if len(msg.lines) > 1 {
+		env = proto.Clone(msg.env).(*v2.Envelope)
+		env.GetLog().Payload = bytes.Join(msg.lines, []byte("\n"))
+	}
+
+	return m.w.Write(env)
+}
+
+// multilineKey identifies the stream of lines an envelope belongs to.
+func multilineKey(env *v2.Envelope) string {
+	return env.GetSourceId() + "/" +
+		env.GetTags()["source_type"] + "/" +
+		env.GetInstanceId() + "/" +
+		env.GetLog().GetType().String()
+}
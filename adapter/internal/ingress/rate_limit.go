@@ -0,0 +1,209 @@
+package ingress
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	v2 "code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+	"github.com/golang/protobuf/proto"
+)
+
+// rateLimitNoticeInterval is how often an app is told that envelopes of one
+// of its drains are being dropped by the rate limit.
+const rateLimitNoticeInterval = time.Minute
+
+// RateLimit is the number of envelopes and bytes per second a binding may
+// write. Zero means unlimited.
+type RateLimit struct {
+	Envelopes int
+	Bytes     int
+}
+
+// parseRateLimit parses the rate-limit drain URL parameter. It is a comma
+// separated list of limits per second. Plain numbers limit envelopes,
+// numbers with a B, KB, MB or GB suffix limit bytes, for example
+// rate-limit=1000,1MB. Limits that are not given are taken from def.
+func parseRateLimit(s string, def RateLimit) (RateLimit, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	l := def
+	for _, p := range strings.Split(s, ",") {
+		p = strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(p), "/s"))
+
+		mult := 0
+		for _, u := range []struct {
+			suffix string
+			mult   int
+		}{
+			{"GB", 1 << 30},
+			{"MB", 1 << 20},
+			{"KB", 1 << 10},
+			{"B", 1},
+		} {
+			if strings.HasSuffix(p, u.suffix) {
+				p = strings.TrimSuffix(p, u.suffix)
+				mult = u.mult
+				break
+			}
+		}
+
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return def, errors.New("invalid rate-limit")
+		}
+
+		if mult == 0 {
+			l.Envelopes = n
+			continue
+		}
+		l.Bytes = n * mult
+	}
+
+	return l, nil
+}
+
+// tokenBucket allows rate tokens per second with bursts of up to one
+// second's worth of tokens. A full bucket admits a single request larger
+// than the burst, which leaves the bucket in debt until it has refilled. A
+// nil bucket allows everything.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &tokenBucket{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if b == nil {
+		return
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) has(n float64) bool {
+	return b == nil || b.tokens >= n || b.tokens >= b.rate
+}
+
+func (b *tokenBucket) take(n float64) {
+	if b != nil {
+		b.tokens -= n
+	}
+}
+
+// rateLimiter holds the token buckets of a binding. It is created once per
+// binding so that reconnecting does not refill the buckets. It is safe for
+// concurrent use, since the multiline writer flushes joined messages from
+// its own goroutine.
+type rateLimiter struct {
+	mu        sync.Mutex
+	envelopes *tokenBucket
+	bytes     *tokenBucket
+	metric    pulseemitter.CounterMetric
+	notify    func(message string)
+	now       func() time.Time
+
+	dropped    uint64
+	lastNotice time.Time
+}
+
+// newRateLimiter returns nil if l does not limit anything.
+func newRateLimiter(
+	l RateLimit,
+	metric pulseemitter.CounterMetric,
+	notify func(message string),
+) *rateLimiter {
+	if l.Envelopes <= 0 && l.Bytes <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	return &rateLimiter{
+		envelopes: newTokenBucket(l.Envelopes, now),
+		bytes:     newTokenBucket(l.Bytes, now),
+		metric:    metric,
+		notify:    notify,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether there are tokens left for the envelope and takes
+// them. The app is told about dropped envelopes at most once per
+// rateLimitNoticeInterval.
+func (r *rateLimiter) allow(env *v2.Envelope) bool {
+	size := 0
+	if r.bytes != nil {
+		size = proto.Size(env)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.envelopes.refill(now)
+	r.bytes.refill(now)
+
+	if r.envelopes.has(1) && r.bytes.has(float64(size)) {
+		r.envelopes.take(1)
+		r.bytes.take(float64(size))
+		return true
+	}
+
+	r.metric.Increment(1)
+	r.dropped++
+	if now.Sub(r.lastNotice) >= rateLimitNoticeInterval {
+		r.notify(fmt.Sprintf("%d envelopes dropped by the rate limit of the syslog drain", r.dropped))
+		r.dropped = 0
+		r.lastNotice = now
+	}
+
+	return false
+}
+
+// rateLimitedWriter drops envelopes that exceed the rate limit of a
+// binding.
+type rateLimitedWriter struct {
+	w       egress.Writer
+	limiter *rateLimiter
+}
+
+func newRateLimitedWriter(w egress.Writer, limiter *rateLimiter) egress.Writer {
+	if limiter == nil {
+		return w
+	}
+
+	return &rateLimitedWriter{w: w, limiter: limiter}
+}
+
+// Write passes the envelope on if the rate limit allows it. Otherwise it is
+// dropped.
+func (r *rateLimitedWriter) Write(env *v2.Envelope) error {
+	if !r.limiter.allow(env) {
+		return nil
+	}
+
+	return r.w.Write(env)
+}
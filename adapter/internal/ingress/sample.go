@@ -0,0 +1,143 @@
+package ingress
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/pulseemitter"
+	v2 "code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
+)
+
+// sampleConfig configures the sampling of the logs of a binding.
+type sampleConfig struct {
+	rate float64
+
+	// tag or field, if set, name the value that is hashed to decide whether
+	// a log is kept, so that logs with the same value are kept or dropped
+	// together.
+	tag   string
+	field *regexp.Regexp
+
+	// errors makes ERR logs subject to sampling.
+	errors bool
+}
+
+// parseSample reads the sample, sample-by and sample-errors drain URL
+// parameters. sample is the fraction of logs kept. sample-by is either
+// tag:<name> or field:<name>, where a field is a key=value or JSON "key":
+// value pair in the payload. Without sample-by logs are sampled at random.
+// ERR logs are kept unless sample-errors=true. It returns nil when sampling
+// is not enabled.
+func parseSample(q url.Values) (*sampleConfig, error) {
+	s := q.Get("sample")
+	if s == "" {
+		return nil, nil
+	}
+
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil || rate <= 0 || rate > 1 {
+		return nil, errors.New("invalid sample")
+	}
+	if rate == 1 {
+		return nil, nil
+	}
+
+	c := &sampleConfig{
+		rate:   rate,
+		errors: q.Get("sample-errors") == "true",
+	}
+
+	if by := q.Get("sample-by"); by != "" {
+		i := strings.Index(by, ":")
+		if i < 0 || i == len(by)-1 {
+			return nil, errors.New("invalid sample-by")
+		}
+
+		name := by[i+1:]
+		switch by[:i] {
+		case "tag":
+			c.tag = name
+		case "field":
+			c.field = regexp.MustCompile(`(?:^|[\s,{])"?` + regexp.QuoteMeta(name) + `"?\s*[:=]\s*"?([^"\s,}]+)`)
+		default:
+			return nil, errors.New("invalid sample-by")
+		}
+	}
+
+	return c, nil
+}
+
+// sampledWriter passes on a fraction of the log envelopes of a binding.
+// Other envelope types are not sampled. It is not safe for concurrent use.
+type sampledWriter struct {
+	w      egress.Writer
+	conf   sampleConfig
+	metric pulseemitter.CounterMetric
+	rand   *rand.Rand
+}
+
+func newSampledWriter(w egress.Writer, conf *sampleConfig, metric pulseemitter.CounterMetric) egress.Writer {
+	if conf == nil {
+		return w
+	}
+
+	return &sampledWriter{
+		w:      w,
+		conf:   *conf,
+		metric: metric,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (s *sampledWriter) Write(env *v2.Envelope) error {
+	if s.keep(env) {
+		return s.w.Write(env)
+	}
+
+	s.metric.Increment(1)
+	return nil
+}
+
+func (s *sampledWriter) keep(env *v2.Envelope) bool {
+	l := env.GetLog()
+	if l == nil {
+		return true
+	}
+
+	if l.GetType() == v2.Log_ERR && !s.conf.errors {
+		return true
+	}
+
+	if key, ok := s.key(env); ok {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		return float64(h.Sum32()) < s.conf.rate*math.MaxUint32
+	}
+
+	return s.rand.Float64() < s.conf.rate
+}
+
+// key returns the value sampled by. Logs without it are sampled at random.
+func (s *sampledWriter) key(env *v2.Envelope) (string, bool) {
+	switch {
+	case s.conf.tag != "":
+		v, ok := env.GetTags()[s.conf.tag]
+		return v, ok
+	case s.conf.field != nil:
+		m := s.conf.field.FindSubmatch(env.GetLog().GetPayload())
+		if m == nil {
+			return "", false
+		}
+		return string(m[1]), true
+	default:
+		return "", false
+	}
+}
@@ -3,6 +3,7 @@ package ingress
 import (
 	"log"
 	"net/url"
+	"strings"
 	"time"
 
 	loggregator "code.cloudfoundry.org/go-loggregator"
@@ -23,6 +24,12 @@ type SyslogConnector interface {
 	Connect(ctx context.Context, binding *v1.Binding) (w egress.Writer, err error)
 }
 
+// bindingRemover is implemented by connectors that keep state for a binding
+// that outlives its connections.
+type bindingRemover interface {
+	Remove(binding *v1.Binding)
+}
+
 // LogClient is used to emit logs.
 type LogClient interface {
 	EmitLog(message string, opts ...loggregator.EmitLogOption)
@@ -61,16 +68,29 @@ func WithMetricsToSyslogEnabled(enabled bool) SubscriberOption {
 	}
 }
 
+// WithRateLimit returns a SubscriberOption that sets the default rate limit
+// of every binding. Bindings can override it with the rate-limit drain URL
+// parameter. By default bindings are not rate limited.
+func WithRateLimit(l RateLimit) SubscriberOption {
+	return func(s *Subscriber) {
+		s.rateLimit = l
+	}
+}
+
 // Subscriber streams loggregator egress to the syslog drain.
 type Subscriber struct {
 	ctx                    context.Context
 	pool                   ClientPool
 	connector              SyslogConnector
 	ingressMetric          pulseemitter.CounterMetric
+	rateLimitedMetric      pulseemitter.CounterMetric
+	filteredMetric         pulseemitter.CounterMetric
+	sampledOutMetric       pulseemitter.CounterMetric
 	logClient              LogClient
 	streamOpenTimeout      time.Duration
 	sourceIndex            string
 	metricsToSyslogEnabled bool
+	rateLimit              RateLimit
 }
 
 type MetricClient interface {
@@ -91,11 +111,33 @@ func NewSubscriber(
 		pulseemitter.WithVersion(2, 0),
 	)
 
+	// metric-documentation-v2: (adapter.rate_limited) Number of envelopes
+	// dropped because a binding exceeded its rate limit.
+	rateLimitedMetric := e.NewCounterMetric("rate_limited",
+		pulseemitter.WithVersion(2, 0),
+	)
+
+	// metric-documentation-v2: (adapter.filtered) Number of envelopes
+	// dropped by the include, exclude, log-type or source-type filters of a
+	// binding.
+	filteredMetric := e.NewCounterMetric("filtered",
+		pulseemitter.WithVersion(2, 0),
+	)
+
+	// metric-documentation-v2: (adapter.sampled_out) Number of envelopes
+	// dropped by the sampling of a binding.
+	sampledOutMetric := e.NewCounterMetric("sampled_out",
+		pulseemitter.WithVersion(2, 0),
+	)
+
 	s := &Subscriber{
 		ctx:                    ctx,
 		pool:                   p,
 		connector:              c,
 		ingressMetric:          ingressMetric,
+		rateLimitedMetric:      rateLimitedMetric,
+		filteredMetric:         filteredMetric,
+		sampledOutMetric:       sampledOutMetric,
 		logClient:              nullLogClient{},
 		streamOpenTimeout:      2 * time.Second,
 		metricsToSyslogEnabled: false,
@@ -110,7 +152,7 @@ func NewSubscriber(
 
 // Start begins to stream logs from a loggregator egress client to the syslog
 // egress writer. Start does not block. Start returns a function that can be
-// called to stop streaming logs.
+// called to stop streaming logs once the binding is removed.
 func (s *Subscriber) Start(binding *v1.Binding) func() {
 	ctx, cancel := context.WithCancel(s.ctx)
 
@@ -124,30 +166,105 @@ func (s *Subscriber) Start(binding *v1.Binding) func() {
 		s.emitErrorLog(binding.AppId, "Invalid drain-type")
 	}
 
-	go s.connectAndRead(ctx, binding, selectors)
+	limit, err := parseRateLimit(url.Query().Get("rate-limit"), s.rateLimit)
+	if err != nil {
+		// Running unlimited could flood the drain the limit protects.
+		s.emitErrorLog(binding.AppId, "Invalid rate-limit, not draining logs")
+		return cancel
+	}
+
+	multiline, err := parseMultiline(url.Query())
+	if err != nil {
+		s.emitErrorLog(binding.AppId, "Invalid multiline options")
+	}
 
-	return cancel
+	filter, err := parseLogFilter(url.Query())
+	if err != nil {
+		// Running without the filter could send logs the app meant to keep
+		// out of the drain.
+		s.emitErrorLog(binding.AppId, "Invalid filter options, not draining logs")
+		return cancel
+	}
+
+	sample, err := parseSample(url.Query())
+	if err != nil {
+		// Running without sampling could send far more logs than the drain
+		// was meant to receive.
+		s.emitErrorLog(binding.AppId, "Invalid sample options, not draining logs")
+		return cancel
+	}
+
+	// The limiter outlives reconnects so that they do not refill its
+	// buckets.
+	limiter := newRateLimiter(limit, s.rateLimitedMetric, func(message string) {
+		s.emitErrorLog(binding.AppId, message)
+	})
+
+	go s.connectAndRead(ctx, binding, drainConfig{
+		selectors:   selectors,
+		rateLimiter: limiter,
+		multiline:   multiline,
+		filter:      filter,
+		sample:      sample,
+	})
+
+	return func() {
+		cancel()
+		if r, ok := s.connector.(bindingRemover); ok {
+			r.Remove(binding)
+		}
+	}
+}
+
+// drainConfig holds the options read from the drain URL of a binding.
+type drainConfig struct {
+	selectors   []*v2.Selector
+	rateLimiter *rateLimiter
+	multiline   *multilineConfig
+	filter      *logFilter
+	sample      *sampleConfig
 }
 
-func (s *Subscriber) connectAndRead(ctx context.Context, binding *v1.Binding, selectors []*v2.Selector) {
+func (s *Subscriber) connectAndRead(ctx context.Context, binding *v1.Binding, conf drainConfig) {
 	for !isDone(ctx) {
-		cont := s.attemptConnectAndRead(ctx, binding, selectors)
+		cont := s.attemptConnectAndRead(ctx, binding, conf)
 		if !cont {
 			return
 		}
 	}
 }
 
-func (s *Subscriber) attemptConnectAndRead(ctx context.Context, binding *v1.Binding, selectors []*v2.Selector) bool {
+func (s *Subscriber) attemptConnectAndRead(ctx context.Context, binding *v1.Binding, conf drainConfig) bool {
 	var cancel func()
 	ctx, cancel = context.WithCancel(ctx)
 	defer cancel()
 
-	writer, err := s.connector.Connect(ctx, binding)
+	// The connection gets its own context so that the messages still held
+	// by the multiline writer are written before it is closed.
+	connCtx, closeConn := context.WithCancel(s.ctx)
+	writer, err := s.connector.Connect(connCtx, binding)
 	if err != nil {
+		closeConn()
 		log.Printf("Failed connecting to syslog: %s", err)
 		return false
 	}
+	writer = newRateLimitedWriter(writer, conf.rateLimiter)
+	writer = newSampledWriter(writer, conf.sample, s.sampledOutMetric)
+	writer = newFilteredWriter(writer, conf.filter, s.filteredMetric)
+	writer, stopMultiline := newMultilineWriter(writer, conf.multiline)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		<-ctx.Done()
+		stopMultiline()
+		closeConn()
+	}()
+	defer func() {
+		cancel()
+		<-closed
+	}()
+	selectors := conf.selectors
 
 	client := s.pool.Next()
 
@@ -279,74 +396,63 @@ func (s *Subscriber) emitErrorLog(appID, message string) {
 	s.logClient.EmitLog(message, option)
 }
 
+// drainTypes maps each drain-type value to the envelope types it selects.
+// The all type is kept to logs and metrics so that existing drains do not
+// start receiving timers and events.
+var drainTypes = map[string][]string{
+	"logs":    {"log"},
+	"metrics": {"gauge", "counter"},
+	"timers":  {"timer"},
+	"events":  {"event"},
+	"all":     {"log", "gauge", "counter"},
+}
+
+// buildRequestSelectors returns the selectors for a comma separated list of
+// drain types. Unknown drain types fall back to logs and are reported as
+// invalid.
 func (s *Subscriber) buildRequestSelectors(appID, drainType string) ([]*v2.Selector, bool) {
-	if !s.metricsToSyslogEnabled {
-		return []*v2.Selector{
-			{
-				SourceId: appID,
-				Message: &v2.Selector_Log{
-					Log: &v2.LogSelector{},
-				},
-			},
-		}, true
+	logs := []*v2.Selector{buildSelector(appID, "log")}
+	if !s.metricsToSyslogEnabled || drainType == "" {
+		return logs, true
 	}
 
-	switch drainType {
-	case "", "logs":
-		return []*v2.Selector{
-			{
-				SourceId: appID,
-				Message: &v2.Selector_Log{
-					Log: &v2.LogSelector{},
-				},
-			},
-		}, true
-	case "metrics":
-		return []*v2.Selector{
-			{
-				SourceId: appID,
-				Message: &v2.Selector_Gauge{
-					Gauge: &v2.GaugeSelector{},
-				},
-			},
-			{
-				SourceId: appID,
-				Message: &v2.Selector_Counter{
-					Counter: &v2.CounterSelector{},
-				},
-			},
-		}, true
-	case "all":
-		return []*v2.Selector{
-			{
-				SourceId: appID,
-				Message: &v2.Selector_Log{
-					Log: &v2.LogSelector{},
-				},
-			},
-			{
-				SourceId: appID,
-				Message: &v2.Selector_Gauge{
-					Gauge: &v2.GaugeSelector{},
-				},
-			},
-			{
-				SourceId: appID,
-				Message: &v2.Selector_Counter{
-					Counter: &v2.CounterSelector{},
-				},
-			},
-		}, true
+	var selectors []*v2.Selector
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(drainType, ",") {
+		types, ok := drainTypes[strings.TrimSpace(t)]
+		if !ok {
+			return logs, false
+		}
+
+		for _, typ := range types {
+			if seen[typ] {
+				continue
+			}
+			seen[typ] = true
+			selectors = append(selectors, buildSelector(appID, typ))
+		}
+	}
+
+	return selectors, true
+}
+
+func buildSelector(appID, envelopeType string) *v2.Selector {
+	selector := &v2.Selector{SourceId: appID}
+
+	switch envelopeType {
+	case "gauge":
+		selector.Message = &v2.Selector_Gauge{Gauge: &v2.GaugeSelector{}}
+	case "counter":
+		selector.Message = &v2.Selector_Counter{Counter: &v2.CounterSelector{}}
+	case "timer":
+		selector.Message = &v2.Selector_Timer{Timer: &v2.TimerSelector{}}
+	case "event":
+		selector.Message = &v2.Selector_Event{Event: &v2.EventSelector{}}
 	default:
-		return []*v2.Selector{
-			{
-				SourceId: appID,
-				Message: &v2.Selector_Log{
-					Log: &v2.LogSelector{},
-				},
-			},
-		}, false
+		selector.Message = &v2.Selector_Log{Log: &v2.LogSelector{}}
 	}
+
+	return selector
 }
 
 func isDone(ctx context.Context) bool {
@@ -18,10 +18,23 @@ import (
 	"google.golang.org/grpc/status"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Subscriber", func() {
+	// stops holds the stop functions of the bindings started by a spec.
+	// Stopping them keeps their reconnect loops from running into the
+	// following specs.
+	var stops []func()
+
+	AfterEach(func() {
+		for _, stop := range stops {
+			stop()
+		}
+		stops = nil
+	})
+
 	It("opens a stream with a batching egress client", func() {
 		spyClientPool := newSpyClientPool()
 		spyEmitter := testhelper.NewMetricClient()
@@ -48,7 +61,7 @@ var _ = Describe("Subscriber", func() {
 			Hostname: "some-host-name",
 			Drain:    "some-drain",
 		}
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Eventually(client.batchedReceiverRequest).ShouldNot(BeNil())
 		Expect(client.batchedReceiverRequest().Selectors[0].GetSourceId()).To(Equal(binding.AppId))
@@ -84,7 +97,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Eventually(client.receiverRequest).ShouldNot(BeNil())
 		Expect(client.receiverRequest().LegacySelector.GetSourceId()).To(Equal(binding.AppId))
@@ -121,7 +134,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Eventually(spyClientPool.nextCalls).Should(BeNumerically(">", 1))
 	})
@@ -151,7 +164,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Eventually(receiver.recvCalls).Should(BeNumerically(">=", 1))
 	})
@@ -182,7 +195,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Eventually(client.invalidated).Should(Equal(true))
 	})
@@ -212,7 +225,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Eventually(client.invalidated).Should(Equal(true))
 	})
@@ -241,7 +254,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Consistently(client.invalidated).Should(Equal(false))
 	})
@@ -268,7 +281,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Eventually(client.invalidated).Should(Equal(true))
 	})
@@ -297,7 +310,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Eventually(client.invalidated).Should(Equal(true))
 	})
@@ -341,6 +354,7 @@ var _ = Describe("Subscriber", func() {
 		Eventually(syslogConnectorCtx.Done).Should(BeClosed())
 		Eventually(receiverCtx.Done).Should(BeClosed())
 		Eventually(receiver.closeSendCalled).Should(BeTrue())
+		Expect(syslogConnector.removed()).To(ConsistOf(binding))
 	})
 
 	It("times out after a configuration duration when opening a stream", func() {
@@ -368,7 +382,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(0),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		// Ensure the context is threaded down.
 		Eventually(syslogConnector.connectContext).ShouldNot(BeNil())
@@ -406,7 +420,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Eventually(spyEmitter.GetMetric("ingress").Delta).Should(Equal(uint64(1)))
 	})
@@ -436,7 +450,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Consistently(writer.writes).Should(BeZero())
 	})
@@ -467,7 +481,7 @@ var _ = Describe("Subscriber", func() {
 			ingress.WithStreamOpenTimeout(500*time.Millisecond),
 		)
 
-		subscriber.Start(binding)
+		stops = append(stops, subscriber.Start(binding))
 
 		Consistently(writer.writes).Should(BeZero())
 	})
@@ -513,7 +527,7 @@ var _ = Describe("Subscriber", func() {
 					Hostname: "some-host-name",
 					Drain:    "https://some-drain?drain-type=metrics",
 				}
-				subscriber.Start(binding)
+				stops = append(stops, subscriber.Start(binding))
 
 				Eventually(client.batchedReceiverRequest).ShouldNot(BeNil())
 
@@ -542,7 +556,7 @@ var _ = Describe("Subscriber", func() {
 					Hostname: "some-host-name",
 					Drain:    "https://some-drain",
 				}
-				subscriber.Start(binding)
+				stops = append(stops, subscriber.Start(binding))
 
 				Eventually(client.batchedReceiverRequest).ShouldNot(BeNil())
 
@@ -571,7 +585,7 @@ var _ = Describe("Subscriber", func() {
 					Hostname: "some-host-name",
 					Drain:    "https://some-drain?drain-type=logs",
 				}
-				subscriber.Start(binding)
+				stops = append(stops, subscriber.Start(binding))
 
 				Eventually(client.batchedReceiverRequest).ShouldNot(BeNil())
 
@@ -600,7 +614,7 @@ var _ = Describe("Subscriber", func() {
 					Hostname: "some-host-name",
 					Drain:    "https://some-drain?drain-type=metrics",
 				}
-				subscriber.Start(binding)
+				stops = append(stops, subscriber.Start(binding))
 
 				Eventually(client.batchedReceiverRequest).ShouldNot(BeNil())
 
@@ -631,7 +645,7 @@ var _ = Describe("Subscriber", func() {
 					Hostname: "some-host-name",
 					Drain:    "https://some-drain?drain-type=all",
 				}
-				subscriber.Start(binding)
+				stops = append(stops, subscriber.Start(binding))
 
 				Eventually(client.batchedReceiverRequest).ShouldNot(BeNil())
 
@@ -645,6 +659,40 @@ var _ = Describe("Subscriber", func() {
 			})
 		})
 
+		Context("when drain-type is a list", func() {
+			It("requests every selected envelope type once", func() {
+				subscriber := ingress.NewSubscriber(
+					context.TODO(),
+					spyClientPool,
+					syslogConnector,
+					spyEmitter,
+					ingress.WithStreamOpenTimeout(500*time.Millisecond),
+					ingress.WithMetricsToSyslogEnabled(true),
+				)
+
+				binding := &v1.Binding{
+					AppId:    "some-app-id",
+					Hostname: "some-host-name",
+					Drain:    "https://some-drain?drain-type=timers,events,logs,all",
+				}
+				stops = append(stops, subscriber.Start(binding))
+
+				Eventually(client.batchedReceiverRequest).ShouldNot(BeNil())
+
+				req := client.batchedReceiverRequest()
+				Expect(req.GetSelectors()).To(HaveLen(5))
+
+				Expect(req.GetSelectors()[0].GetTimer()).ToNot(BeNil())
+				Expect(req.GetSelectors()[1].GetEvent()).ToNot(BeNil())
+				Expect(req.GetSelectors()[2].GetLog()).ToNot(BeNil())
+				Expect(req.GetSelectors()[3].GetGauge()).ToNot(BeNil())
+				Expect(req.GetSelectors()[4].GetCounter()).ToNot(BeNil())
+				for _, s := range req.GetSelectors() {
+					Expect(s.GetSourceId()).To(Equal("some-app-id"))
+				}
+			})
+		})
+
 		It("emits a log to the logstream on invalid drain-type", func() {
 			subscriber := ingress.NewSubscriber(
 				context.TODO(),
@@ -661,7 +709,7 @@ var _ = Describe("Subscriber", func() {
 				Hostname: "some-host-name",
 				Drain:    "https://some-drain?drain-type=false-drain",
 			}
-			subscriber.Start(binding)
+			stops = append(stops, subscriber.Start(binding))
 
 			Eventually(client.batchedReceiverRequest).ShouldNot(BeNil())
 			Expect(client.batchedReceiverRequest().GetLegacySelector().GetLog()).ToNot(BeNil())
@@ -677,8 +725,308 @@ var _ = Describe("Subscriber", func() {
 			Expect(logClient.sourceInstance()).To(HaveKey("some-source-index"))
 		})
 	})
+
+	// startDrain starts a subscriber for a binding with the given drain URL.
+	// The subscriber receives batch once and the stream is then held open
+	// until the spec ends.
+	startDrain := func(drain string, batch []*v2.Envelope, opts ...ingress.SubscriberOption) *drainSpies {
+		d := &drainSpies{
+			emitter:   testhelper.NewMetricClient(),
+			connector: newSpySyslogConnector(),
+			writer:    newSpyWriter(),
+			logClient: newSpyLogClient(),
+		}
+		d.connector.connect = d.writer
+		d.writer.ctx = d.connector.connectContext
+		spyClientPool := newSpyClientPool()
+		client := newSpyLogsProviderClient()
+		spyClientPool.next = client
+		batchedReceiverClient := newSpyBatchedReceiverClient()
+		batchedReceiverClient.recv = &v2.EnvelopeBatch{Batch: batch}
+		batchedReceiverClient.hold = make(chan struct{})
+		client.batchedReceiverClient = batchedReceiverClient
+
+		opts = append(opts,
+			ingress.WithStreamOpenTimeout(500*time.Millisecond),
+			ingress.WithLogClient(d.logClient, "some-source-index"),
+		)
+		subscriber := ingress.NewSubscriber(
+			context.TODO(),
+			spyClientPool,
+			d.connector,
+			d.emitter,
+			opts...,
+		)
+
+		stop := subscriber.Start(&v1.Binding{
+			AppId:    "some-app-id",
+			Hostname: "some-host-name",
+			Drain:    drain,
+		})
+		var once sync.Once
+		d.stop = func() {
+			once.Do(func() {
+				stop()
+				close(batchedReceiverClient.hold)
+			})
+		}
+		stops = append(stops, d.stop)
+
+		return d
+	}
+
+	Describe("rate-limit option", func() {
+		logs := func() []*v2.Envelope {
+			return buildBatchedLogs(5).Batch
+		}
+
+		It("drops envelopes over the default limit", func() {
+			d := startDrain("https://some-drain", logs(), ingress.WithRateLimit(ingress.RateLimit{Envelopes: 2}))
+
+			Eventually(d.emitter.GetMetric("rate_limited").Delta).Should(Equal(uint64(3)))
+			Expect(d.writer.writes()).To(Equal(2))
+			Expect(d.logClient.message()).To(ConsistOf("1 envelopes dropped by the rate limit of the syslog drain"))
+			Expect(d.logClient.appID()).To(ConsistOf("some-app-id"))
+		})
+
+		It("uses the limit of the drain URL", func() {
+			d := startDrain("https://some-drain?rate-limit=4", logs(), ingress.WithRateLimit(ingress.RateLimit{Envelopes: 2}))
+
+			Eventually(d.emitter.GetMetric("rate_limited").Delta).Should(Equal(uint64(1)))
+			Expect(d.writer.writes()).To(Equal(4))
+		})
+
+		It("limits bytes", func() {
+			d := startDrain("https://some-drain?rate-limit=100B", logs())
+
+			Eventually(d.writer.writes).Should(BeNumerically(">", 0))
+			Eventually(d.emitter.GetMetric("rate_limited").Delta).Should(BeNumerically(">", 0))
+			Expect(d.writer.writes()).To(BeNumerically("<", 5))
+		})
+
+		It("lets an envelope larger than the byte limit through a full bucket", func() {
+			d := startDrain("https://some-drain?rate-limit=10B", logs())
+
+			Eventually(d.emitter.GetMetric("rate_limited").Delta).Should(Equal(uint64(4)))
+			Expect(d.writer.writes()).To(Equal(1))
+		})
+
+		It("does not limit by default", func() {
+			d := startDrain("https://some-drain", logs())
+
+			Eventually(d.writer.writes).Should(Equal(5))
+			Expect(d.emitter.GetMetric("rate_limited").Delta()).To(BeZero())
+		})
+
+		It("does not drain logs for an invalid limit", func() {
+			d := startDrain("https://some-drain?rate-limit=fast", logs())
+
+			Expect(d.logClient.message()).To(ContainElement("Invalid rate-limit, not draining logs"))
+			Consistently(d.connector.connectContext).Should(BeNil())
+			Expect(d.writer.writes()).To(BeZero())
+		})
+	})
+
+	Describe("multiline option", func() {
+		lines := func(payloads ...string) []*v2.Envelope {
+			var envs []*v2.Envelope
+			for _, l := range payloads {
+				env := buildLogEnvelope("some-app-id")
+				env.GetLog().Payload = []byte(l + "\n")
+				envs = append(envs, env)
+			}
+			return envs
+		}
+
+		trace := func() []*v2.Envelope {
+			return lines(
+				"Exception in thread \"main\" java.lang.IllegalStateException",
+				"\tat com.example.Main.run(Main.java:10)",
+				"Caused by: java.lang.NullPointerException",
+				"\t... 3 more",
+				"next line",
+			)
+		}
+
+		It("joins stack traces", func() {
+			d := startDrain("https://some-drain?multiline=true&multiline-max-wait=100ms", trace())
+
+			Eventually(d.writer.payloads).Should(Equal([]string{
+				"Exception in thread \"main\" java.lang.IllegalStateException\n" +
+					"\tat com.example.Main.run(Main.java:10)\n" +
+					"Caused by: java.lang.NullPointerException\n" +
+					"\t... 3 more",
+				"next line\n",
+			}))
+		})
+
+		It("flushes after the max lines", func() {
+			d := startDrain("https://some-drain?multiline=true&multiline-max-wait=100ms&multiline-max-lines=2", trace())
+
+			Eventually(d.writer.writes).Should(Equal(3))
+			Expect(d.writer.payloads()[0]).To(HavePrefix("Exception"))
+			Expect(d.writer.payloads()[1]).To(HavePrefix("Caused by:"))
+		})
+
+		It("uses a custom pattern", func() {
+			d := startDrain("https://some-drain?multiline-pattern=%5E%5C%2B&multiline-max-wait=100ms", lines("a", "+b", "+c", "d"))
+
+			Eventually(d.writer.payloads).Should(Equal([]string{"a\n+b\n+c", "d\n"}))
+		})
+
+		It("flushes with a max wait below the flush interval", func() {
+			d := startDrain("https://some-drain?multiline=true&multiline-max-wait=1ns", trace())
+
+			Eventually(d.writer.payloads).Should(ContainElement("next line\n"))
+		})
+
+		It("does not join lines by default", func() {
+			d := startDrain("https://some-drain", trace())
+
+			Eventually(d.writer.writes).Should(Equal(5))
+			Consistently(d.writer.writes).Should(Equal(5))
+		})
+
+		It("writes the pending message before the connection is closed", func() {
+			d := startDrain("https://some-drain?multiline=true&multiline-max-wait=1h", lines("a", " b", "c"))
+			Eventually(d.writer.payloads).Should(Equal([]string{"a\n b"}))
+
+			d.stop()
+
+			Eventually(d.writer.payloads).Should(Equal([]string{"a\n b", "c\n"}))
+			Expect(d.writer.lateWrites()).To(BeZero())
+		})
+
+		It("emits an error log for an invalid pattern", func() {
+			d := startDrain("https://some-drain?multiline-pattern=(", trace())
+
+			Eventually(d.writer.writes).Should(Equal(5))
+			Expect(d.logClient.message()).To(ContainElement("Invalid multiline options"))
+		})
+	})
+
+	Describe("filter options", func() {
+		log := func(sourceType, payload string, t v2.Log_Type) *v2.Envelope {
+			env := buildLogEnvelope("some-app-id")
+			env.Tags["source_type"] = sourceType
+			env.GetLog().Payload = []byte(payload)
+			env.GetLog().Type = t
+			return env
+		}
+		logs := func() []*v2.Envelope {
+			return []*v2.Envelope{
+				log("APP/PROC/WEB", "GET /health 200", v2.Log_OUT),
+				log("APP/PROC/WEB", "GET /orders 500", v2.Log_OUT),
+				log("APP/PROC/WEB", "panic: oops", v2.Log_ERR),
+				log("RTR", "GET /orders 500", v2.Log_OUT),
+				log("STG", "Downloading droplet", v2.Log_OUT),
+			}
+		}
+
+		DescribeTable("drops filtered envelopes", func(query string, expected []string) {
+			d := startDrain("https://some-drain?"+query, logs())
+
+			Eventually(d.emitter.GetMetric("filtered").Delta).Should(Equal(uint64(5 - len(expected))))
+			Eventually(d.writer.payloads).Should(Equal(expected))
+		},
+			Entry("include", "include=%20500$", []string{"GET /orders 500", "GET /orders 500"}),
+			Entry("exclude", "exclude=/health", []string{"GET /orders 500", "panic: oops", "GET /orders 500", "Downloading droplet"}),
+			Entry("log-type", "log-type=err", []string{"panic: oops"}),
+			Entry("source-type", "source-type=APP,RTR", []string{"GET /health 200", "GET /orders 500", "panic: oops", "GET /orders 500"}),
+			Entry("combined", "source-type=APP/PROC/WEB&log-type=out&exclude=/health", []string{"GET /orders 500"}),
+		)
+
+		It("passes all envelopes by default", func() {
+			d := startDrain("https://some-drain", logs())
+
+			Eventually(d.writer.writes).Should(Equal(5))
+			Expect(d.emitter.GetMetric("filtered").Delta()).To(BeZero())
+		})
+
+		DescribeTable("does not drain logs with invalid options", func(query string) {
+			d := startDrain("https://some-drain?"+query, logs())
+
+			Expect(d.logClient.message()).To(ContainElement("Invalid filter options, not draining logs"))
+			Consistently(d.connector.connectContext).Should(BeNil())
+			Expect(d.writer.writes()).To(BeZero())
+		},
+			Entry("invalid regex", "include=("),
+			Entry("invalid log-type", "log-type=debug"),
+		)
+	})
+
+	Describe("sample options", func() {
+		logs := func() []*v2.Envelope {
+			var envs []*v2.Envelope
+			for i := 0; i < 200; i++ {
+				env := buildLogEnvelope("some-app-id")
+				env.Tags["request_id"] = fmt.Sprintf("req-%d", i%20)
+				env.GetLog().Payload = []byte(fmt.Sprintf(`{"request_id":"req-%d","msg":"line %d"}`, i%20, i))
+				if i%10 == 0 {
+					env.GetLog().Type = v2.Log_ERR
+				}
+				envs = append(envs, env)
+			}
+			return envs
+		}
+
+		handled := func(d *drainSpies) func() int {
+			return func() int {
+				return d.writer.writes() + int(d.emitter.GetMetric("sampled_out").Delta())
+			}
+		}
+
+		It("samples logs at random and keeps ERR logs", func() {
+			d := startDrain("https://some-drain?sample=0.5", logs())
+
+			Eventually(handled(d)).Should(Equal(200))
+			Expect(d.emitter.GetMetric("sampled_out").Delta()).To(BeNumerically(">", 0))
+			Expect(d.writer.writes()).To(BeNumerically(">=", 20))
+		})
+
+		It("samples ERR logs with sample-errors", func() {
+			d := startDrain("https://some-drain?sample=0.01&sample-errors=true&sample-by=tag:request_id", logs())
+
+			Eventually(handled(d)).Should(Equal(200))
+			Expect(d.writer.writes()).To(BeNumerically("<", 20))
+		})
+
+		DescribeTable("keeps or drops related logs together", func(query string) {
+			d := startDrain("https://some-drain?sample=0.5&sample-errors=true&"+query, logs())
+
+			Eventually(handled(d)).Should(Equal(200))
+
+			kept := make(map[string]int)
+			for _, p := range d.writer.payloads() {
+				kept[p[:len(`{"request_id":"req-00"`)]]++
+			}
+			for _, n := range kept {
+				Expect(n).To(Equal(10))
+			}
+		},
+			Entry("by tag", "sample-by=tag:request_id"),
+			Entry("by payload field", "sample-by=field:request_id"),
+		)
+
+		It("does not drain logs for an invalid rate", func() {
+			d := startDrain("https://some-drain?sample=2", logs())
+
+			Expect(d.logClient.message()).To(ContainElement("Invalid sample options, not draining logs"))
+			Consistently(d.connector.connectContext).Should(BeNil())
+			Expect(d.writer.writes()).To(BeZero())
+		})
+	})
 })
 
+// drainSpies are the spies of a subscriber started with startDrain.
+type drainSpies struct {
+	emitter   *testhelper.SpyMetricClient
+	connector *spySyslogConnector
+	writer    *spyWriter
+	logClient *spyLogClient
+	stop      func()
+}
+
 type spyCloseWriter struct {
 	writes chan *v2.Envelope
 	closes chan bool
@@ -771,6 +1119,7 @@ type spySyslogConnector struct {
 	mu              sync.Mutex
 	connect         egress.Writer
 	connectContext_ context.Context
+	removed_        []*v1.Binding
 }
 
 func newSpySyslogConnector() *spySyslogConnector {
@@ -795,6 +1144,20 @@ func (s *spySyslogConnector) connectContext() context.Context {
 	return s.connectContext_
 }
 
+func (s *spySyslogConnector) Remove(binding *v1.Binding) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removed_ = append(s.removed_, binding)
+}
+
+func (s *spySyslogConnector) removed() []*v1.Binding {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removed_
+}
+
 type spyLogsProviderClient struct {
 	mu sync.Mutex
 
@@ -924,6 +1287,8 @@ type spyBatchedReceiverClient struct {
 	mu   sync.Mutex
 	recv *v2.EnvelopeBatch
 	done bool
+	// hold, if set, keeps the stream open after recv until it is closed.
+	hold chan struct{}
 	grpc.ClientStream
 }
 
@@ -933,12 +1298,17 @@ func (s *spyBatchedReceiverClient) CloseSend() error {
 
 func (s *spyBatchedReceiverClient) Recv() (*v2.EnvelopeBatch, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.done {
 		s.done = true
+		s.mu.Unlock()
 		return s.recv, nil
 	}
+	hold := s.hold
+	s.mu.Unlock()
+
+	if hold != nil {
+		<-hold
+	}
 
 	return nil, errors.New("no more data")
 }
@@ -994,18 +1364,39 @@ func newSpyWriter() *spyWriter {
 }
 
 type spyWriter struct {
-	mu      sync.Mutex
-	writes_ int
+	mu          sync.Mutex
+	writes_     int
+	payloads_   []string
+	ctx         func() context.Context
+	lateWrites_ int
 }
 
-func (s *spyWriter) Write(*v2.Envelope) error {
+func (s *spyWriter) Write(env *v2.Envelope) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.writes_ += 1
+	s.payloads_ = append(s.payloads_, string(env.GetLog().GetPayload()))
+	if s.ctx != nil && s.ctx().Err() != nil {
+		s.lateWrites_ += 1
+	}
 
 	return nil
 }
 
+// lateWrites returns the number of writes after the context of the
+// connection was done.
+func (s *spyWriter) lateWrites() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lateWrites_
+}
+
+func (s *spyWriter) payloads() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payloads_
+}
+
 func (s *spyWriter) writes() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
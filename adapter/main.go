@@ -13,6 +13,7 @@ import (
 	"code.cloudfoundry.org/go-loggregator"
 	"code.cloudfoundry.org/go-loggregator/pulseemitter"
 	"code.cloudfoundry.org/scalable-syslog/adapter/app"
+	"code.cloudfoundry.org/scalable-syslog/adapter/internal/egress"
 	"code.cloudfoundry.org/scalable-syslog/internal/api"
 )
 
@@ -51,6 +52,32 @@ func main() {
 		log.Fatalf("Invalid Metric Ingress TLS config: %s", err)
 	}
 
+	drainTLSConfig, err := api.NewDrainTLSConfig(
+		cfg.DrainCAFile,
+		cfg.DrainTLSMinVersion,
+		cfg.DrainTLSCipherSuites,
+	)
+	if err != nil {
+		log.Fatalf("Invalid drain TLS config: %s", err)
+	}
+
+	var redactionRules []egress.RedactionRule
+	if cfg.RedactionRulesFile != "" {
+		redactionRules, err = egress.LoadRedactionRules(cfg.RedactionRulesFile)
+		if err != nil {
+			log.Fatalf("Invalid redaction rules: %s", err)
+		}
+	}
+
+	drainProxy, err := egress.NewProxy(
+		cfg.DrainHTTPProxy,
+		cfg.DrainSOCKS5Proxy,
+		cfg.DrainNoProxy,
+	)
+	if err != nil {
+		log.Fatalf("Invalid drain proxy config: %s", err)
+	}
+
 	logClient, err := loggregator.NewIngressClient(
 		metricIngressTLS,
 		loggregator.WithTag("origin", "cf-syslog-drain.adapter"),
@@ -84,6 +111,15 @@ func main() {
 		app.WithSyslogSkipCertVerify(cfg.SyslogSkipCertVerify),
 		app.WithMetricsToSyslogEnabled(cfg.MetricsToSyslogEnabled),
 		app.WithMaxBindings(cfg.MaxBindings),
+		app.WithHTTPSBatching(cfg.HTTPSBatchSize, cfg.HTTPSBatchDelay),
+		app.WithCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerOpenTimeout),
+		app.WithSpill(cfg.SpillDir, cfg.SpillMaxBindingBytes, cfg.SpillMaxTotalBytes),
+		app.WithRetryStrategy(cfg.RetryStrategy),
+		app.WithRateLimit(cfg.RateLimitEnvelopes, cfg.RateLimitBytes),
+		app.WithDrainTLSConfig(drainTLSConfig),
+		app.WithRedactionRules(redactionRules),
+		app.WithSharedConnections(cfg.SharedConnections),
+		app.WithDrainProxy(drainProxy),
 	)
 	go adapter.Start()
 	defer adapter.Stop()
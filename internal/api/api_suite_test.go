@@ -1,6 +1,8 @@
 package api_test
 
 import (
+	"os"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -11,3 +13,20 @@ func TestApi(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Api Suite")
 }
+
+// systemCA stands in for a public CA. It is made the only system root
+// through SSL_CERT_FILE, which is read when the system pool is first loaded.
+var (
+	systemCA     *testCA
+	systemCAFile string
+)
+
+var _ = BeforeSuite(func() {
+	systemCA = newTestCA("public-ca")
+	systemCAFile = writeFile(systemCA.certPEM)
+	os.Setenv("SSL_CERT_FILE", systemCAFile)
+})
+
+var _ = AfterSuite(func() {
+	os.Remove(systemCAFile)
+})
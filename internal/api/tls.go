@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -52,6 +53,79 @@ func NewMutualTLSConfig(certFile, keyFile, caCertFile, serverName string) (*tls.
 	return tlsConfig, err
 }
 
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewDrainTLSConfig returns the tls.Config used to connect to syslog drains.
+// The CA file is optional and is trusted in addition to the system roots, so
+// that drains with internal and public certificates can both be verified.
+// The minimum version is one of 1.0, 1.1, 1.2 or 1.3 and cipher suites are
+// given by their Go names. Empty values keep the defaults of NewTLSConfig.
+func NewDrainTLSConfig(caCertFile, minVersion string, cipherSuites []string) (*tls.Config, error) {
+	tlsConfig := NewTLSConfig()
+
+	if caCertFile != "" {
+		certBytes, err := ioutil.ReadFile(caCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read drain ca cert file: %s", err.Error())
+		}
+
+		caCertPool, err := x509.SystemCertPool()
+		if err != nil {
+			caCertPool = x509.NewCertPool()
+		}
+		if ok := caCertPool.AppendCertsFromPEM(certBytes); !ok {
+			return nil, errors.New("unable to load drain ca cert file")
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	if minVersion != "" {
+		v, ok := tlsVersions[minVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version: %s", minVersion)
+		}
+		tlsConfig.MinVersion = v
+	}
+
+	if len(cipherSuites) > 0 {
+		ids, err := cipherSuiteIDs(cipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = ids
+	}
+
+	return tlsConfig, nil
+}
+
+func cipherSuiteIDs(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+
+	var ids []uint16
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite: %s", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
 func addCA(tlsConfig *tls.Config, tlsCert tls.Certificate, caCertFile string) error {
 	certBytes, err := ioutil.ReadFile(caCertFile)
 	if err != nil {
@@ -1,10 +1,19 @@
 package api_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"os"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -106,6 +115,68 @@ var _ = Describe("TLS", func() {
 		})
 	})
 
+	Context("NewDrainTLSConfig", func() {
+		It("uses the defaults of NewTLSConfig", func() {
+			conf, err := api.NewDrainTLSConfig("", "", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(conf.RootCAs).To(BeNil())
+			Expect(conf.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+			Expect(conf.CipherSuites).To(Equal(api.NewTLSConfig().CipherSuites))
+		})
+
+		It("loads the CA and sets the version and cipher suites", func() {
+			caCertFilename := writeFile(caCert)
+			defer os.Remove(caCertFilename)
+
+			conf, err := api.NewDrainTLSConfig(caCertFilename, "1.3", []string{
+				"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+				"TLS_AES_128_GCM_SHA256",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(conf.RootCAs).ToNot(BeNil())
+			Expect(conf.MinVersion).To(Equal(uint16(tls.VersionTLS13)))
+			Expect(conf.CipherSuites).To(Equal([]uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_AES_128_GCM_SHA256,
+			}))
+		})
+
+		It("trusts the CA in addition to the system roots", func() {
+			privateCA := newTestCA("private-ca")
+			unknownCA := newTestCA("unknown-ca")
+
+			caCertFilename := writeFile(privateCA.certPEM)
+			defer os.Remove(caCertFilename)
+
+			conf, err := api.NewDrainTLSConfig(caCertFilename, "", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(handshake(systemCA, conf)).To(Succeed())
+			Expect(handshake(privateCA, conf)).To(Succeed())
+			Expect(handshake(unknownCA, conf)).ToNot(Succeed())
+		})
+
+		It("returns an error for an unknown version", func() {
+			_, err := api.NewDrainTLSConfig("", "1.4", nil)
+			Expect(err).To(MatchError("unknown TLS version: 1.4"))
+		})
+
+		It("returns an error for an unknown cipher suite", func() {
+			_, err := api.NewDrainTLSConfig("", "", []string{"TLS_NOPE"})
+			Expect(err).To(MatchError("unsupported cipher suite: TLS_NOPE"))
+		})
+
+		It("returns an error for an invalid CA file", func() {
+			empty := writeFile("")
+			defer os.Remove(empty)
+
+			_, err := api.NewDrainTLSConfig(empty, "", nil)
+			Expect(err).To(MatchError("unable to load drain ca cert file"))
+		})
+	})
+
 	Context("NewTLSConfig", func() {
 		It("returns basic TLS config", func() {
 			tlsConf := api.NewTLSConfig()
@@ -118,6 +189,84 @@ var _ = Describe("TLS", func() {
 	})
 })
 
+// testCA is a certificate authority that issues server certificates for
+// 127.0.0.1.
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM string
+}
+
+func newTestCA(name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+
+	return &testCA{
+		cert:    cert,
+		key:     key,
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+func (ca *testCA) serverCert() tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).ToNot(HaveOccurred())
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshake connects with conf to a server whose certificate is issued by
+// ca.
+func handshake(ca *testCA, conf *tls.Config) error {
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{ca.serverCert()},
+	})
+	Expect(err).ToNot(HaveOccurred())
+	defer lis.Close()
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), conf)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
 func writeFile(data string) string {
 	f, err := ioutil.TempFile("", "")
 	Expect(err).ToNot(HaveOccurred())
@@ -40,9 +40,11 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type Binding struct {
-	AppId    string `protobuf:"bytes,1,opt,name=appId" json:"appId,omitempty"`
-	Hostname string `protobuf:"bytes,2,opt,name=hostname" json:"hostname,omitempty"`
-	Drain    string `protobuf:"bytes,3,opt,name=drain" json:"drain,omitempty"`
+	AppId          string `protobuf:"bytes,1,opt,name=appId" json:"appId,omitempty"`
+	Hostname       string `protobuf:"bytes,2,opt,name=hostname" json:"hostname,omitempty"`
+	Drain          string `protobuf:"bytes,3,opt,name=drain" json:"drain,omitempty"`
+	ClientCertFile string `protobuf:"bytes,4,opt,name=clientCertFile" json:"clientCertFile,omitempty"`
+	ClientKeyFile  string `protobuf:"bytes,5,opt,name=clientKeyFile" json:"clientKeyFile,omitempty"`
 }
 
 func (m *Binding) Reset()                    { *m = Binding{} }
@@ -71,6 +73,20 @@ func (m *Binding) GetDrain() string {
 	return ""
 }
 
+func (m *Binding) GetClientCertFile() string {
+	if m != nil {
+		return m.ClientCertFile
+	}
+	return ""
+}
+
+func (m *Binding) GetClientKeyFile() string {
+	if m != nil {
+		return m.ClientKeyFile
+	}
+	return ""
+}
+
 type ListBindingsRequest struct {
 }
 
@@ -294,23 +310,25 @@ var _Adapter_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("adapter.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 284 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x92, 0xbd, 0x4e, 0xc3, 0x30,
-	0x14, 0x85, 0x9b, 0x56, 0x90, 0x72, 0xa1, 0x0c, 0x26, 0x55, 0xa3, 0x4c, 0x95, 0x01, 0xa9, 0x53,
-	0x24, 0xda, 0x27, 0xe0, 0x67, 0xa9, 0x60, 0x21, 0x2b, 0x12, 0x92, 0x43, 0xae, 0x4a, 0xa4, 0x60,
-	0x9b, 0x5c, 0x33, 0xf0, 0x42, 0x3c, 0x27, 0x6a, 0xec, 0x56, 0xcd, 0x8f, 0xc2, 0xc2, 0x78, 0xed,
-	0x73, 0xbf, 0xe3, 0x73, 0x12, 0x98, 0x88, 0x4c, 0x68, 0x83, 0x65, 0xac, 0x4b, 0x65, 0x14, 0x3b,
-	0xa7, 0x37, 0x51, 0x88, 0xb4, 0x40, 0xfa, 0xa6, 0x42, 0x6d, 0xf8, 0x33, 0xf8, 0x77, 0xb9, 0xcc,
-	0x72, 0xb9, 0x61, 0x01, 0x1c, 0x09, 0xad, 0xd7, 0x59, 0xe8, 0xcd, 0xbd, 0xc5, 0x49, 0x62, 0x07,
-	0x16, 0xc1, 0xf8, 0x5d, 0x91, 0x91, 0xe2, 0x03, 0xc3, 0x61, 0x75, 0xb1, 0x9f, 0xb7, 0x1b, 0x59,
-	0x29, 0x72, 0x19, 0x8e, 0xec, 0x46, 0x35, 0xf0, 0x29, 0x5c, 0x3c, 0xe5, 0x64, 0x1c, 0x96, 0x12,
-	0xfc, 0xfc, 0x42, 0x32, 0xfc, 0x11, 0x82, 0xfa, 0x31, 0x69, 0x25, 0x09, 0xd9, 0x0a, 0xc6, 0xa9,
-	0x3b, 0x0b, 0xbd, 0xf9, 0x68, 0x71, 0xba, 0x9c, 0xc5, 0xf5, 0x47, 0xc6, 0x6e, 0x27, 0xd9, 0x0b,
-	0xf9, 0x1a, 0x82, 0xfb, 0x12, 0x85, 0xc1, 0xdd, 0x95, 0x35, 0x61, 0x37, 0xe0, 0x3b, 0x4d, 0x95,
-	0xa2, 0x87, 0xb5, 0xd3, 0xf1, 0x19, 0x4c, 0x1b, 0x28, 0xfb, 0xb0, 0xad, 0xc7, 0x03, 0x16, 0xf8,
-	0x4f, 0x1e, 0x0d, 0x94, 0xf5, 0x58, 0xfe, 0x0c, 0xc1, 0xbf, 0xb5, 0x1f, 0x88, 0xbd, 0xc0, 0xd9,
-	0x61, 0x41, 0xec, 0xb2, 0x89, 0xed, 0x68, 0x35, 0xba, 0xea, 0x17, 0xb9, 0x28, 0x03, 0xf6, 0x0a,
-	0x93, 0x5a, 0x4a, 0xd6, 0x5a, 0xec, 0xea, 0x33, 0xba, 0xfe, 0x43, 0x75, 0xc8, 0xaf, 0x25, 0x6c,
-	0xf3, 0xbb, 0xba, 0x6c, 0xf3, 0x3b, 0x6b, 0xe2, 0x83, 0xf4, 0xb8, 0xfa, 0x7d, 0x57, 0xbf, 0x01,
-	0x00, 0x00, 0xff, 0xff, 0xba, 0x87, 0x9a, 0x05, 0xcf, 0x02, 0x00, 0x00,
+	// 313 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x93, 0xc1, 0x4e, 0xc2, 0x40,
+	0x10, 0x86, 0x2d, 0x88, 0xc5, 0xd1, 0x72, 0x58, 0x4b, 0x68, 0x7a, 0x22, 0x15, 0x0c, 0xa7, 0x26,
+	0xc2, 0x13, 0x28, 0xc6, 0x84, 0xe0, 0xa9, 0x57, 0x13, 0x93, 0x2d, 0x9d, 0xe0, 0x26, 0xeb, 0xb6,
+	0x76, 0xd7, 0x03, 0x4f, 0xe3, 0xcd, 0xe7, 0x34, 0xec, 0xb6, 0x84, 0x96, 0x06, 0x2e, 0x1c, 0xe7,
+	0x9f, 0x6f, 0xfe, 0xd9, 0xf9, 0x9b, 0x82, 0x43, 0x13, 0x9a, 0x29, 0xcc, 0xc3, 0x2c, 0x4f, 0x55,
+	0x4a, 0x7a, 0x72, 0x45, 0x39, 0x8d, 0x39, 0xca, 0x8d, 0xe4, 0xe9, 0x3a, 0xf8, 0xb5, 0xc0, 0x7e,
+	0x66, 0x22, 0x61, 0x62, 0x4d, 0x5c, 0xe8, 0xd0, 0x2c, 0x5b, 0x24, 0x9e, 0x35, 0xb4, 0x26, 0xd7,
+	0x91, 0x29, 0x88, 0x0f, 0xdd, 0xcf, 0x54, 0x2a, 0x41, 0xbf, 0xd0, 0x6b, 0xe9, 0xc6, 0xae, 0xde,
+	0x4e, 0x24, 0x39, 0x65, 0xc2, 0x6b, 0x9b, 0x09, 0x5d, 0x90, 0x07, 0xe8, 0xad, 0x38, 0x43, 0xa1,
+	0xe6, 0x98, 0xab, 0x57, 0xc6, 0xd1, 0xbb, 0xd4, 0xed, 0x9a, 0x4a, 0x46, 0xe0, 0x18, 0x65, 0x89,
+	0x1b, 0x8d, 0x75, 0x34, 0x56, 0x15, 0x83, 0x3e, 0xdc, 0xbd, 0x31, 0xa9, 0x8a, 0x47, 0xca, 0x08,
+	0xbf, 0x7f, 0x50, 0xaa, 0x60, 0x09, 0x6e, 0x55, 0x96, 0x59, 0x2a, 0x24, 0x92, 0x19, 0x74, 0xe3,
+	0x42, 0xf3, 0xac, 0x61, 0x7b, 0x72, 0x33, 0x1d, 0x84, 0xd5, 0x9b, 0xc3, 0x62, 0x26, 0xda, 0x81,
+	0xc1, 0x02, 0xdc, 0x79, 0x8e, 0x54, 0x61, 0xd9, 0x32, 0x4b, 0xc8, 0x23, 0xd8, 0x05, 0xa3, 0x33,
+	0x39, 0xe2, 0x55, 0x72, 0xc1, 0x00, 0xfa, 0x35, 0x2b, 0xf3, 0xb0, 0xed, 0x8e, 0x17, 0xe4, 0x78,
+	0xa6, 0x1d, 0x35, 0x2b, 0xb3, 0x63, 0xfa, 0xd7, 0x02, 0xfb, 0xc9, 0x7c, 0x6f, 0xf2, 0x0e, 0xb7,
+	0xfb, 0x01, 0x91, 0xfb, 0xba, 0x6d, 0x43, 0xaa, 0xfe, 0xe8, 0x38, 0x54, 0x9c, 0x72, 0x41, 0x3e,
+	0xc0, 0xa9, 0x5c, 0x49, 0x0e, 0x06, 0x9b, 0xf2, 0xf4, 0xc7, 0x27, 0xa8, 0x7d, 0xff, 0xca, 0x85,
+	0x87, 0xfe, 0x4d, 0x59, 0xfa, 0xe3, 0x13, 0x54, 0xe9, 0x1f, 0x5f, 0xe9, 0xbf, 0x61, 0xf6, 0x3f,
+	0x00, 0xf8, 0x55, 0x7f, 0x58, 0x1e, 0x03, 0x00, 0x00,
 }
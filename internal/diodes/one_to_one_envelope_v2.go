@@ -24,3 +24,13 @@ func (d *OneToOne) Next() *loggregator_v2.Envelope {
 	data := d.d.Next()
 	return (*loggregator_v2.Envelope)(data)
 }
+
+// TryNext returns the next envelope if one is available.
+func (d *OneToOne) TryNext() (*loggregator_v2.Envelope, bool) {
+	data, ok := d.d.TryNext()
+	if !ok {
+		return nil, ok
+	}
+
+	return (*loggregator_v2.Envelope)(data), true
+}
@@ -11,14 +11,16 @@ import (
 
 // The Health handler will report the number of drains back to user.
 type Health struct {
-	counts map[string]int
-	mu     sync.RWMutex
+	counts  map[string]int
+	details map[string]interface{}
+	mu      sync.RWMutex
 }
 
 // NewHealth returns a new Health handler.
 func NewHealth() *Health {
 	return &Health{
-		counts: make(map[string]int),
+		counts:  make(map[string]int),
+		details: make(map[string]interface{}),
 	}
 }
 
@@ -27,7 +29,7 @@ func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 	h.mu.RLock()
-	jsonCounts, err := json.Marshal(h.counts)
+	jsonCounts, err := json.Marshal(h.report())
 	h.mu.RUnlock()
 
 	if err != nil {
@@ -44,3 +46,32 @@ func (h *Health) SetCounter(c map[string]int) {
 		h.counts[k] = v
 	}
 }
+
+// SetDetail reports an arbitrary JSON value under the given name. Setting a
+// nil value removes it from the report.
+func (h *Health) SetDetail(name string, v interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if v == nil {
+		delete(h.details, name)
+		return
+	}
+	h.details[name] = v
+}
+
+func (h *Health) report() interface{} {
+	if len(h.details) == 0 {
+		return h.counts
+	}
+
+	r := make(map[string]interface{}, len(h.counts)+len(h.details))
+	for k, v := range h.counts {
+		r[k] = v
+	}
+	for k, v := range h.details {
+		r[k] = v
+	}
+
+	return r
+}
@@ -46,4 +46,21 @@ var _ = Describe("Health", func() {
 		handler.ServeHTTP(recorder, new(http.Request))
 		Expect(recorder.Body.Bytes()).To(MatchJSON(`{"aCounter": 1, "bCounter": 2, "cCounter": 100}`))
 	})
+
+	It("reports details next to the counters", func() {
+		handler.SetCounter(map[string]int{"drainCount": 2})
+		handler.SetDetail("circuitBreakers", map[string]string{"app-id syslog://host": "open"})
+
+		handler.ServeHTTP(recorder, new(http.Request))
+		Expect(recorder.Body.Bytes()).To(MatchJSON(`{"drainCount": 2, "circuitBreakers": {"app-id syslog://host": "open"}}`))
+	})
+
+	It("removes details that are set to nil", func() {
+		handler.SetCounter(map[string]int{"drainCount": 2})
+		handler.SetDetail("circuitBreakers", map[string]string{"app-id syslog://host": "open"})
+		handler.SetDetail("circuitBreakers", nil)
+
+		handler.ServeHTTP(recorder, new(http.Request))
+		Expect(recorder.Body.Bytes()).To(MatchJSON(`{"drainCount": 2}`))
+	})
 })
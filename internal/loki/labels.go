@@ -0,0 +1,23 @@
+// Package loki holds what the adapter and the scheduler share about Loki
+// drains.
+package loki
+
+// LabelName turns a tag name into a valid Loki label name by replacing
+// invalid characters with underscores.
+func LabelName(n string) string {
+	b := []byte(n)
+	for i, c := range b {
+		valid := c == '_' ||
+			(c >= 'a' && c <= 'z') ||
+			(c >= 'A' && c <= 'Z') ||
+			(i > 0 && c >= '0' && c <= '9')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+
+	return string(b)
+}
@@ -0,0 +1,20 @@
+package loki_test
+
+import (
+	"code.cloudfoundry.org/scalable-syslog/internal/loki"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LabelName", func() {
+	DescribeTable("turns tag names into label names", func(tag, label string) {
+		Expect(loki.LabelName(tag)).To(Equal(label))
+	},
+		Entry("valid name", "source_type", "source_type"),
+		Entry("invalid characters", "a.b-c", "a_b_c"),
+		Entry("leading digit", "1st", "_st"),
+		Entry("empty name", "", "_"),
+	)
+})
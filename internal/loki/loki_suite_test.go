@@ -0,0 +1,13 @@
+package loki_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLoki(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Loki Suite")
+}
@@ -26,7 +26,8 @@ type Config struct {
 	KeyFile           string `env:"KEY_FILE_PATH,       required"`
 	AdapterCommonName string `env:"ADAPTER_COMMON_NAME, required"`
 
-	Blacklist *ingress.BlacklistRanges `env:"BLACKLIST"`
+	Blacklist       *ingress.BlacklistRanges `env:"BLACKLIST"`
+	ClientCertStore string                   `env:"CLIENT_CERT_STORE_PATH"`
 
 	AdapterPort  string   `env:"ADAPTER_PORT,  required"`
 	AdapterAddrs []string `env:"ADAPTER_ADDRS, required"`
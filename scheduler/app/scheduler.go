@@ -32,6 +32,7 @@ type Scheduler struct {
 	fetcher          *ingress.FilteredBindingFetcher
 	logClient        LogClient
 	blacklist        *ingress.BlacklistRanges
+	clientCertStore  string
 }
 
 // Emitter sends gauge metrics
@@ -113,6 +114,14 @@ func WithBlacklist(r *ingress.BlacklistRanges) func(*Scheduler) {
 	}
 }
 
+// WithClientCertStore sets the path to a JSON file that assigns client
+// certificates to drains. See ingress.ClientCertStore for the format.
+func WithClientCertStore(path string) func(*Scheduler) {
+	return func(s *Scheduler) {
+		s.clientCertStore = path
+	}
+}
+
 // Start starts polling the syslog drain binding provider and serves the HTTP
 // health endpoint.
 func (s *Scheduler) Start() string {
@@ -131,6 +140,9 @@ func (s *Scheduler) setupIngress() {
 			BatchSize: s.apiBatchSize,
 		},
 	)
+	if s.clientCertStore != "" {
+		fetcher = ingress.NewClientCertBindingFetcher(fetcher, s.clientCertStore)
+	}
 
 	s.fetcher = ingress.NewFilteredBindingFetcher(s.blacklist, fetcher, s.logClient)
 }
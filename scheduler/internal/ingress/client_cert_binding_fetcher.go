@@ -0,0 +1,97 @@
+package ingress
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/url"
+
+	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
+)
+
+// ClientCertificate references a client certificate and key. The paths are
+// resolved on the adapters.
+type ClientCertificate struct {
+	CertFile string `json:"cert"`
+	KeyFile  string `json:"key"`
+}
+
+// ClientCertStore assigns client certificates to drains. Apps are keyed by
+// app ID and drains by the host and port of the drain URL. An entry for the
+// app takes precedence over an entry for the drain.
+type ClientCertStore struct {
+	Apps   map[string]ClientCertificate `json:"apps"`
+	Drains map[string]ClientCertificate `json:"drains"`
+}
+
+// ClientCertBindingFetcher adds client certificate references from a
+// ClientCertStore file to the bindings of another BindingReader.
+type ClientCertBindingFetcher struct {
+	br    BindingReader
+	path  string
+	store ClientCertStore
+}
+
+// NewClientCertBindingFetcher returns a ClientCertBindingFetcher that reads
+// the store from the JSON file at path.
+func NewClientCertBindingFetcher(br BindingReader, path string) *ClientCertBindingFetcher {
+	return &ClientCertBindingFetcher{
+		br:   br,
+		path: path,
+	}
+}
+
+// FetchBindings returns the bindings of the wrapped BindingReader. The store
+// is read again on every call so that changes do not need a restart. If it
+// cannot be read the previous store is used.
+func (f *ClientCertBindingFetcher) FetchBindings() ([]v1.Binding, error) {
+	bindings, err := f.br.FetchBindings()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.reload(); err != nil {
+		log.Printf("failed to load client certificate store %s: %s", f.path, err)
+	}
+
+	for i, b := range bindings {
+		cert, ok := f.lookup(b)
+		if !ok {
+			continue
+		}
+
+		bindings[i].ClientCertFile = cert.CertFile
+		bindings[i].ClientKeyFile = cert.KeyFile
+	}
+
+	return bindings, nil
+}
+
+func (f *ClientCertBindingFetcher) reload() error {
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	var store ClientCertStore
+	if err := json.Unmarshal(b, &store); err != nil {
+		return err
+	}
+	f.store = store
+
+	return nil
+}
+
+func (f *ClientCertBindingFetcher) lookup(b v1.Binding) (ClientCertificate, bool) {
+	if cert, ok := f.store.Apps[b.AppId]; ok {
+		return cert, true
+	}
+
+	u, err := url.Parse(b.Drain)
+	if err != nil {
+		return ClientCertificate{}, false
+	}
+	cert, ok := f.store.Drains[u.Host]
+
+	return cert, ok
+}
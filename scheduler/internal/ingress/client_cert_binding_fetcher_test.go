@@ -0,0 +1,78 @@
+package ingress_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+
+	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
+	"code.cloudfoundry.org/scalable-syslog/scheduler/internal/ingress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ClientCertBindingFetcher", func() {
+	var (
+		storeFile string
+		reader    *SpyBindingReader
+		fetcher   *ingress.ClientCertBindingFetcher
+	)
+
+	writeStore := func(data string) {
+		Expect(ioutil.WriteFile(storeFile, []byte(data), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		f, err := ioutil.TempFile("", "client-certs")
+		Expect(err).ToNot(HaveOccurred())
+		f.Close()
+		storeFile = f.Name()
+
+		writeStore(`{
+			"apps": {"app-1": {"cert": "/app-1.crt", "key": "/app-1.key"}},
+			"drains": {"collector:6514": {"cert": "/collector.crt", "key": "/collector.key"}}
+		}`)
+
+		reader = &SpyBindingReader{
+			bindings: []v1.Binding{
+				{AppId: "app-1", Drain: "syslog-tls://collector:6514"},
+				{AppId: "app-2", Drain: "syslog-tls://collector:6514"},
+				{AppId: "app-3", Drain: "syslog-tls://other:6514"},
+			},
+		}
+		fetcher = ingress.NewClientCertBindingFetcher(reader, storeFile)
+	})
+
+	AfterEach(func() {
+		os.Remove(storeFile)
+	})
+
+	It("adds client certificates by app and by drain", func() {
+		bindings, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(bindings).To(Equal([]v1.Binding{
+			{AppId: "app-1", Drain: "syslog-tls://collector:6514", ClientCertFile: "/app-1.crt", ClientKeyFile: "/app-1.key"},
+			{AppId: "app-2", Drain: "syslog-tls://collector:6514", ClientCertFile: "/collector.crt", ClientKeyFile: "/collector.key"},
+			{AppId: "app-3", Drain: "syslog-tls://other:6514"},
+		}))
+	})
+
+	It("keeps the previous store when the file becomes invalid", func() {
+		_, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+
+		writeStore("invalid")
+		bindings, err := fetcher.FetchBindings()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bindings[0].ClientCertFile).To(Equal("/app-1.crt"))
+	})
+
+	It("returns errors of the wrapped reader", func() {
+		reader.err = errors.New("some-error")
+
+		_, err := fetcher.FetchBindings()
+		Expect(err).To(MatchError("some-error"))
+	})
+})
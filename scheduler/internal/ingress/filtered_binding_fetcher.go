@@ -1,15 +1,26 @@
 package ingress
 
 import (
+	"crypto/x509"
 	"fmt"
 	"log"
 	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	loggregator "code.cloudfoundry.org/go-loggregator"
 	v1 "code.cloudfoundry.org/scalable-syslog/internal/api/v1"
+	"code.cloudfoundry.org/scalable-syslog/internal/loki"
 )
 
-var allowedSchemes = []string{"syslog", "syslog-tls", "https"}
+var allowedSchemes = []string{"syslog", "syslog-tls", "syslog-udp", "https", "splunk", "splunk-hec", "elasticsearch", "loki", "otlp-grpc", "otlp-http"}
+
+var allowedFramings = []string{"", "octet", "lf", "nul"}
+
+var allowedFormats = []string{"", "rfc5424", "rfc3164", "json", "ndjson"}
 
 type BindingReader interface {
 	FetchBindings() (appBindings []v1.Binding, err error)
@@ -59,6 +70,51 @@ func (f *FilteredBindingFetcher) FetchBindings() ([]v1.Binding, int, error) {
 			continue
 		}
 
+		if invalidFraming(binding.Drain) {
+			f.emitErrorLog(binding.AppId, "Invalid syslog drain URL: unknown framing")
+			continue
+		}
+
+		if invalidFormat(binding.Drain) {
+			f.emitErrorLog(binding.AppId, "Invalid syslog drain URL: unknown format")
+			continue
+		}
+
+		if invalidTimezone(binding.Drain) {
+			f.emitErrorLog(binding.AppId, "Invalid syslog drain URL: unknown timezone")
+			continue
+		}
+
+		if param, ok := invalidFilter(binding.Drain); ok {
+			f.emitErrorLog(binding.AppId, fmt.Sprintf("Invalid syslog drain URL: invalid %s", param))
+			continue
+		}
+
+		if param, ok := invalidMultiline(binding.Drain); ok {
+			f.emitErrorLog(binding.AppId, fmt.Sprintf("Invalid syslog drain URL: invalid %s", param))
+			continue
+		}
+
+		if invalidRateLimit(binding.Drain) {
+			f.emitErrorLog(binding.AppId, "Invalid syslog drain URL: invalid rate-limit")
+			continue
+		}
+
+		if param, ok := invalidSample(binding.Drain); ok {
+			f.emitErrorLog(binding.AppId, fmt.Sprintf("Invalid syslog drain URL: invalid %s", param))
+			continue
+		}
+
+		if scheme == "loki" && invalidLokiLabels(binding.Drain) {
+			f.emitErrorLog(binding.AppId, "Invalid syslog drain URL: invalid include-tags")
+			continue
+		}
+
+		if invalidCA(binding.Drain) {
+			f.emitErrorLog(binding.AppId, "Invalid syslog drain URL: invalid ca")
+			continue
+		}
+
 		ip, err := f.ipChecker.ResolveAddr(host)
 		if err != nil {
 			msg := fmt.Sprintf("Failed to resolve syslog drain host: %s", host)
@@ -100,3 +156,214 @@ func invalidScheme(scheme string) bool {
 
 	return true
 }
+
+func invalidFraming(drain string) bool {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return true
+	}
+
+	framing := u.Query().Get("framing")
+	for _, f := range allowedFramings {
+		if f == framing {
+			return false
+		}
+	}
+
+	return true
+}
+
+func invalidFormat(drain string) bool {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return true
+	}
+
+	format := u.Query().Get("format")
+	for _, f := range allowedFormats {
+		if f == format {
+			return false
+		}
+	}
+
+	return true
+}
+
+// invalidTimezone reports whether the drain sets a timezone query parameter
+// that is not a known IANA timezone name.
+func invalidTimezone(drain string) bool {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return true
+	}
+
+	tz := u.Query().Get("timezone")
+	if tz == "" {
+		return false
+	}
+
+	_, err = time.LoadLocation(tz)
+	return err != nil
+}
+
+// invalidFilter reports whether the include or exclude query parameter of the
+// drain is not a valid regular expression or the log-type query parameter is
+// neither out nor err, and which one.
+func invalidFilter(drain string) (string, bool) {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return "", false
+	}
+	q := u.Query()
+
+	for _, param := range []string{"include", "exclude"} {
+		if _, err := regexp.Compile(q.Get(param)); err != nil {
+			return param + " regex", true
+		}
+	}
+
+	switch strings.ToLower(q.Get("log-type")) {
+	case "", "out", "err":
+	default:
+		return "log-type", true
+	}
+
+	return "", false
+}
+
+// invalidMultiline reports whether one of the multiline query parameters of
+// the drain is invalid, and which one.
+func invalidMultiline(drain string) (string, bool) {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return "", false
+	}
+	q := u.Query()
+
+	if _, err := regexp.Compile(q.Get("multiline-pattern")); err != nil {
+		return "multiline-pattern", true
+	}
+
+	if s := q.Get("multiline-max-lines"); s != "" {
+		if n, err := strconv.Atoi(s); err != nil || n <= 0 {
+			return "multiline-max-lines", true
+		}
+	}
+
+	if s := q.Get("multiline-max-wait"); s != "" {
+		if d, err := time.ParseDuration(s); err != nil || d <= 0 {
+			return "multiline-max-wait", true
+		}
+	}
+
+	return "", false
+}
+
+// invalidRateLimit reports whether the rate-limit query parameter of the
+// drain is not a comma separated list of non-negative limits per second,
+// each optionally followed by B, KB, MB or GB.
+func invalidRateLimit(drain string) bool {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return true
+	}
+
+	v := u.Query().Get("rate-limit")
+	if v == "" {
+		return false
+	}
+
+	for _, p := range strings.Split(v, ",") {
+		p = strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(p), "/s"))
+		for _, suffix := range []string{"GB", "MB", "KB", "B"} {
+			if strings.HasSuffix(p, suffix) {
+				p = strings.TrimSuffix(p, suffix)
+				break
+			}
+		}
+
+		if n, err := strconv.Atoi(p); err != nil || n < 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// invalidSample reports whether the sample query parameter of the drain is
+// not a fraction in (0, 1] or sample-by is neither tag:<name> nor
+// field:<name>, and which one.
+func invalidSample(drain string) (string, bool) {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return "", false
+	}
+	q := u.Query()
+
+	if s := q.Get("sample"); s != "" {
+		if rate, err := strconv.ParseFloat(s, 64); err != nil || rate <= 0 || rate > 1 {
+			return "sample", true
+		}
+	}
+
+	if by := q.Get("sample-by"); by != "" {
+		i := strings.Index(by, ":")
+		if i < 0 || i == len(by)-1 || (by[:i] != "tag" && by[:i] != "field") {
+			return "sample-by", true
+		}
+	}
+
+	return "", false
+}
+
+// invalidLokiLabels reports whether the include-tags query parameter of a
+// loki drain selects a tag that would replace the app_id or hostname label,
+// or two tags that map to the same label name.
+func invalidLokiLabels(drain string) bool {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return true
+	}
+
+	v := u.Query().Get("include-tags")
+	if v == "true" || v == "false" {
+		return false
+	}
+
+	labels := map[string]bool{
+		"app_id":   true,
+		"hostname": true,
+	}
+	names := make(map[string]bool)
+	for _, n := range strings.Split(v, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" || names[n] {
+			continue
+		}
+		names[n] = true
+
+		l := loki.LabelName(n)
+		if labels[l] {
+			return true
+		}
+		labels[l] = true
+	}
+
+	return false
+}
+
+// invalidCA reports whether the drain sets a ca query parameter that does not
+// contain a PEM encoded certificate.
+func invalidCA(drain string) bool {
+	u, err := url.Parse(drain)
+	if err != nil {
+		return true
+	}
+
+	ca := u.Query().Get("ca")
+	if ca == "" {
+		return false
+	}
+
+	return !x509.NewCertPool().AppendCertsFromPEM([]byte(ca))
+}
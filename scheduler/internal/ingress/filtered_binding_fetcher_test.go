@@ -89,7 +89,14 @@ var _ = Describe("FilteredBindingFetcher", func() {
 			input = []v1.Binding{
 				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10"},
 				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog-tls://10.10.10.10"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog-udp://10.10.10.10"},
 				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "https://10.10.10.10"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "splunk://10.10.10.10"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "splunk-hec://10.10.10.10"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "elasticsearch://10.10.10.10"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "loki://10.10.10.10"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "otlp-grpc://10.10.10.10"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "otlp-http://10.10.10.10"},
 				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "bad-scheme://10.10.10.10"},
 				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "blah://10.10.10.10"},
 			}
@@ -104,10 +111,365 @@ var _ = Describe("FilteredBindingFetcher", func() {
 		It("ignores the bindings", func() {
 			actual, removed, err := filter.FetchBindings()
 
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(input[:10]))
+			Expect(removed).To(Equal(2))
+		})
+	})
+
+	Context("when syslog drain has an unknown framing", func() {
+		var (
+			filter    *ingress.FilteredBindingFetcher
+			logClient *spyLogClient
+			input     []v1.Binding
+		)
+
+		BeforeEach(func() {
+			input = []v1.Binding{
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?framing=octet"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?framing=lf"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog-tls://10.10.10.10?framing=nul"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?framing=crlf"},
+			}
+
+			logClient = &spyLogClient{}
+
+			filter = ingress.NewFilteredBindingFetcher(
+				&spyIPChecker{},
+				&SpyBindingReader{bindings: input},
+				logClient,
+			)
+		})
+
+		It("removes the binding", func() {
+			actual, removed, err := filter.FetchBindings()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(input[:3]))
+			Expect(removed).To(Equal(1))
+		})
+
+		It("emitts a LGR error", func() {
+			_, _, _ = filter.FetchBindings()
+
+			Expect(logClient.calledWith).To(Equal("Invalid syslog drain URL: unknown framing"))
+			Expect(logClient.appID).To(Equal("app-id"))
+			Expect(logClient.sourceType).To(Equal("LGR"))
+		})
+	})
+
+	Context("when syslog drain has an unknown format", func() {
+		var (
+			filter    *ingress.FilteredBindingFetcher
+			logClient *spyLogClient
+			input     []v1.Binding
+		)
+
+		BeforeEach(func() {
+			input = []v1.Binding{
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "https://10.10.10.10?format=json"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "https://10.10.10.10?format=ndjson"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?format=rfc3164"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "https://10.10.10.10?format=xml"},
+			}
+
+			logClient = &spyLogClient{}
+
+			filter = ingress.NewFilteredBindingFetcher(
+				&spyIPChecker{},
+				&SpyBindingReader{bindings: input},
+				logClient,
+			)
+		})
+
+		It("removes the binding", func() {
+			actual, removed, err := filter.FetchBindings()
+
 			Expect(err).ToNot(HaveOccurred())
 			Expect(actual).To(Equal(input[:3]))
+			Expect(removed).To(Equal(1))
+		})
+
+		It("emitts a LGR error", func() {
+			_, _, _ = filter.FetchBindings()
+
+			Expect(logClient.calledWith).To(Equal("Invalid syslog drain URL: unknown format"))
+			Expect(logClient.appID).To(Equal("app-id"))
+		})
+	})
+
+	Context("when syslog drain has an invalid filter", func() {
+		var (
+			filter    *ingress.FilteredBindingFetcher
+			logClient *spyLogClient
+			input     []v1.Binding
+		)
+
+		BeforeEach(func() {
+			input = []v1.Binding{
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?include=ERR&exclude=%2Fhealth&log-type=ERR"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?log-type=debug"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?exclude=%28"},
+			}
+
+			logClient = &spyLogClient{}
+
+			filter = ingress.NewFilteredBindingFetcher(
+				&spyIPChecker{},
+				&SpyBindingReader{bindings: input},
+				logClient,
+			)
+		})
+
+		It("removes the bindings", func() {
+			actual, removed, err := filter.FetchBindings()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(input[:1]))
 			Expect(removed).To(Equal(2))
 		})
+
+		It("emitts a LGR error", func() {
+			_, _, _ = filter.FetchBindings()
+
+			Expect(logClient.calledWith).To(Equal("Invalid syslog drain URL: invalid exclude regex"))
+			Expect(logClient.appID).To(Equal("app-id"))
+		})
+	})
+
+	Context("when syslog drain has invalid multiline options", func() {
+		var (
+			filter    *ingress.FilteredBindingFetcher
+			logClient *spyLogClient
+			input     []v1.Binding
+		)
+
+		BeforeEach(func() {
+			input = []v1.Binding{
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?multiline=true&multiline-max-lines=10&multiline-max-wait=1ns"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?multiline-pattern=%28"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?multiline=true&multiline-max-lines=0"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?multiline=true&multiline-max-wait=-1s"},
+			}
+
+			logClient = &spyLogClient{}
+
+			filter = ingress.NewFilteredBindingFetcher(
+				&spyIPChecker{},
+				&SpyBindingReader{bindings: input},
+				logClient,
+			)
+		})
+
+		It("removes the bindings", func() {
+			actual, removed, err := filter.FetchBindings()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(input[:1]))
+			Expect(removed).To(Equal(3))
+		})
+
+		It("emitts a LGR error", func() {
+			_, _, _ = filter.FetchBindings()
+
+			Expect(logClient.calledWith).To(Equal("Invalid syslog drain URL: invalid multiline-max-wait"))
+			Expect(logClient.appID).To(Equal("app-id"))
+		})
+	})
+
+	Context("when syslog drain has an invalid rate limit", func() {
+		var (
+			filter    *ingress.FilteredBindingFetcher
+			logClient *spyLogClient
+			input     []v1.Binding
+		)
+
+		BeforeEach(func() {
+			input = []v1.Binding{
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?rate-limit=1000,1MB/s"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?rate-limit=fast"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?rate-limit=-1"},
+			}
+
+			logClient = &spyLogClient{}
+
+			filter = ingress.NewFilteredBindingFetcher(
+				&spyIPChecker{},
+				&SpyBindingReader{bindings: input},
+				logClient,
+			)
+		})
+
+		It("removes the bindings", func() {
+			actual, removed, err := filter.FetchBindings()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(input[:1]))
+			Expect(removed).To(Equal(2))
+		})
+
+		It("emitts a LGR error", func() {
+			_, _, _ = filter.FetchBindings()
+
+			Expect(logClient.calledWith).To(Equal("Invalid syslog drain URL: invalid rate-limit"))
+			Expect(logClient.appID).To(Equal("app-id"))
+		})
+	})
+
+	Context("when syslog drain has invalid sample options", func() {
+		var (
+			filter    *ingress.FilteredBindingFetcher
+			logClient *spyLogClient
+			input     []v1.Binding
+		)
+
+		BeforeEach(func() {
+			input = []v1.Binding{
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?sample=0.1&sample-by=tag:request_id"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?sample=2"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?sample=0.1&sample-by=request_id"},
+			}
+
+			logClient = &spyLogClient{}
+
+			filter = ingress.NewFilteredBindingFetcher(
+				&spyIPChecker{},
+				&SpyBindingReader{bindings: input},
+				logClient,
+			)
+		})
+
+		It("removes the bindings", func() {
+			actual, removed, err := filter.FetchBindings()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(input[:1]))
+			Expect(removed).To(Equal(2))
+		})
+
+		It("emitts a LGR error", func() {
+			_, _, _ = filter.FetchBindings()
+
+			Expect(logClient.calledWith).To(Equal("Invalid syslog drain URL: invalid sample-by"))
+			Expect(logClient.appID).To(Equal("app-id"))
+		})
+	})
+
+	Context("when loki drain has tags that map to the same label", func() {
+		var (
+			filter    *ingress.FilteredBindingFetcher
+			logClient *spyLogClient
+			input     []v1.Binding
+		)
+
+		BeforeEach(func() {
+			input = []v1.Binding{
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "loki://10.10.10.10?include-tags=deployment,job"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "https://10.10.10.10?include-tags=app_id"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "loki://10.10.10.10?include-tags=app_id"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "loki://10.10.10.10?include-tags=a.b,a-b"},
+			}
+
+			logClient = &spyLogClient{}
+
+			filter = ingress.NewFilteredBindingFetcher(
+				&spyIPChecker{},
+				&SpyBindingReader{bindings: input},
+				logClient,
+			)
+		})
+
+		It("removes the bindings", func() {
+			actual, removed, err := filter.FetchBindings()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(input[:2]))
+			Expect(removed).To(Equal(2))
+		})
+
+		It("emitts a LGR error", func() {
+			_, _, _ = filter.FetchBindings()
+
+			Expect(logClient.calledWith).To(Equal("Invalid syslog drain URL: invalid include-tags"))
+			Expect(logClient.appID).To(Equal("app-id"))
+		})
+	})
+
+	Context("when syslog drain has an unknown timezone", func() {
+		var (
+			filter    *ingress.FilteredBindingFetcher
+			logClient *spyLogClient
+			input     []v1.Binding
+		)
+
+		BeforeEach(func() {
+			input = []v1.Binding{
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?format=rfc3164&timezone=Europe/Berlin"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog://10.10.10.10?format=rfc3164&timezone=Mars/Olympus"},
+			}
+
+			logClient = &spyLogClient{}
+
+			filter = ingress.NewFilteredBindingFetcher(
+				&spyIPChecker{},
+				&SpyBindingReader{bindings: input},
+				logClient,
+			)
+		})
+
+		It("removes the binding", func() {
+			actual, removed, err := filter.FetchBindings()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(input[:1]))
+			Expect(removed).To(Equal(1))
+		})
+
+		It("emitts a LGR error", func() {
+			_, _, _ = filter.FetchBindings()
+
+			Expect(logClient.calledWith).To(Equal("Invalid syslog drain URL: unknown timezone"))
+			Expect(logClient.appID).To(Equal("app-id"))
+		})
+	})
+
+	Context("when syslog drain has an invalid ca", func() {
+		var (
+			filter    *ingress.FilteredBindingFetcher
+			logClient *spyLogClient
+			input     []v1.Binding
+		)
+
+		BeforeEach(func() {
+			input = []v1.Binding{
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog-tls://10.10.10.10?servername=collector"},
+				v1.Binding{AppId: "app-id", Hostname: "we.dont.care", Drain: "syslog-tls://10.10.10.10?ca=not-a-cert"},
+			}
+
+			logClient = &spyLogClient{}
+
+			filter = ingress.NewFilteredBindingFetcher(
+				&spyIPChecker{},
+				&SpyBindingReader{bindings: input},
+				logClient,
+			)
+		})
+
+		It("removes the binding", func() {
+			actual, removed, err := filter.FetchBindings()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(Equal(input[:1]))
+			Expect(removed).To(Equal(1))
+		})
+
+		It("emitts a LGR error", func() {
+			_, _, _ = filter.FetchBindings()
+
+			Expect(logClient.calledWith).To(Equal("Invalid syslog drain URL: invalid ca"))
+			Expect(logClient.appID).To(Equal("app-id"))
+			Expect(logClient.sourceType).To(Equal("LGR"))
+		})
 	})
 
 	Context("when the drain host fails to resolve", func() {